@@ -0,0 +1,453 @@
+package ceph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 授权的权限
+const (
+	PermissionFullControl = "FULL_CONTROL"
+	PermissionRead        = "READ"
+	PermissionWrite       = "WRITE"
+	PermissionReadACP     = "READ_ACP"
+	PermissionWriteACP    = "WRITE_ACP"
+)
+
+// Grantee的类型
+const (
+	GranteeCanonicalUser = "CanonicalUser"
+	GranteeGroup         = "Group"
+	GranteeEmail         = "AmazonCustomerByEmail"
+)
+
+// 预定义的用户组
+const (
+	GroupAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	GroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	GroupLogDelivery        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+type AccessControlPolicy struct {
+	XMLName xml.Name `xml:"AccessControlPolicy"`
+	Owner   Owner    `xml:"Owner"`
+	Grants  []Grant  `xml:"AccessControlList>Grant"`
+}
+
+type Grant struct {
+	Grantee    Grantee `xml:"Grantee"`
+	Permission string  `xml:"Permission"`
+}
+
+// Grantee: 根据Type使用ID | URI | EmailAddress
+type Grantee struct {
+	Type         string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	ID           string `xml:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty"`
+	URI          string `xml:"URI,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+func NewUserGrantee(id string) Grantee {
+	return Grantee{Type: GranteeCanonicalUser, ID: id}
+}
+
+func NewGroupGrantee(uri string) Grantee {
+	return Grantee{Type: GranteeGroup, URI: uri}
+}
+
+func NewEmailGrantee(email string) Grantee {
+	return Grantee{Type: GranteeEmail, EmailAddress: email}
+}
+
+// granteeXML: RGW按照字面的"xsi:type"查找属性, 序列化时不能使用encoding/xml生成的命名空间前缀
+type granteeXML struct {
+	XMLName      xml.Name `xml:"Grantee"`
+	Xmlns        string   `xml:"xmlns:xsi,attr"`
+	Type         string   `xml:"xsi:type,attr"`
+	ID           string   `xml:"ID,omitempty"`
+	DisplayName  string   `xml:"DisplayName,omitempty"`
+	URI          string   `xml:"URI,omitempty"`
+	EmailAddress string   `xml:"EmailAddress,omitempty"`
+}
+
+func (g Grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(granteeXML{
+		Xmlns:        xsiNamespace,
+		Type:         g.Type,
+		ID:           g.ID,
+		DisplayName:  g.DisplayName,
+		URI:          g.URI,
+		EmailAddress: g.EmailAddress,
+	})
+}
+
+// headerValue: x-amz-grant-*头中的格式, 比如id="xxx"
+func (g Grantee) headerValue() string {
+	switch {
+	case len(g.ID) > 0:
+		return fmt.Sprintf("id=\"%s\"", g.ID)
+	case len(g.URI) > 0:
+		return fmt.Sprintf("uri=\"%s\"", g.URI)
+	default:
+		return fmt.Sprintf("emailAddress=\"%s\"", g.EmailAddress)
+	}
+}
+
+// addGrant: 把grantees添加到permission对应的x-amz-grant-*头, 比如READ_ACP对应x-amz-grant-read-acp
+func addGrant(h http.Header, permission string, grantees []Grantee) {
+	key := "X-Amz-Grant-" + strings.ReplaceAll(strings.ToLower(permission), "_", "-")
+
+	values := make([]string, 0, len(grantees)+1)
+	if v := h.Get(key); len(v) > 0 {
+		values = append(values, v)
+	}
+	for _, g := range grantees {
+		values = append(values, g.headerValue())
+	}
+	h.Set(key, strings.Join(values, ", "))
+}
+
+// aclOption: 设置ACL的三种方式, canned ACL和x-amz-grant-*头不能和AccessControlPolicy同时使用
+type aclOption struct {
+	canned string
+	grants http.Header
+	policy *AccessControlPolicy
+}
+
+func (o *aclOption) setCanned(acl string) {
+	o.canned = acl
+}
+
+func (o *aclOption) addGrant(permission string, grantees []Grantee) {
+	if o.grants == nil {
+		o.grants = make(http.Header)
+	}
+	addGrant(o.grants, permission, grantees)
+}
+
+func (o *aclOption) validate() error {
+	if len(o.canned) > 0 && len(o.grants) > 0 {
+		return errors.New("Canned ACL can not be used with grants")
+	}
+	if o.policy != nil && (len(o.canned) > 0 || len(o.grants) > 0) {
+		return errors.New("AccessControlPolicy can not be used with canned ACL or grants")
+	}
+	return nil
+}
+
+func (o *aclOption) setHeader(h http.Header) {
+	if len(o.canned) > 0 {
+		h.Set("X-Amz-Acl", o.canned)
+	}
+	for k, v := range o.grants {
+		h[k] = v
+	}
+}
+
+//////////////////////////////////////////////////////////////////
+type GetBucketACLRequest struct {
+	bucket string // [required]
+}
+
+func NewGetBucketACLRequest(bucket string) *GetBucketACLRequest {
+	return &GetBucketACLRequest{
+		bucket: bucket,
+	}
+}
+
+func (r *GetBucketACLRequest) Do(p *RequestParam) Response {
+	var gbaresp = &GetBucketACLResponse{}
+
+	// 参数校验
+	if p == nil {
+		gbaresp.err = errors.New("Nil RequestParam")
+		return gbaresp
+	}
+	if err := p.Validate(); err != nil {
+		gbaresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return gbaresp
+	}
+	if len(r.bucket) <= 0 {
+		gbaresp.err = errors.New("Empty bucket name")
+		return gbaresp
+	}
+
+	gbaresp.err = getACL(p, p.objectURL(r.bucket, "", "acl"), &gbaresp.AccessControlPolicy)
+	return gbaresp
+}
+
+type GetBucketACLResponse struct {
+	AccessControlPolicy
+
+	err error
+}
+
+func (r GetBucketACLResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type PutBucketACLRequest struct {
+	bucket string // [required]
+
+	// [required] SetACL | SetGrant | SetPolicy至少设置一个
+	acl aclOption
+}
+
+func NewPutBucketACLRequest(bucket string) *PutBucketACLRequest {
+	return &PutBucketACLRequest{
+		bucket: bucket,
+	}
+}
+
+// SetACL: 设置canned ACL, 比如ACLPrivate
+func (r *PutBucketACLRequest) SetACL(acl string) *PutBucketACLRequest {
+	r.acl.setCanned(acl)
+	return r
+}
+
+// SetGrant: 通过x-amz-grant-*头授予grantees权限, 可以多次调用
+// @param permission: PermissionRead | PermissionWrite | ...
+func (r *PutBucketACLRequest) SetGrant(permission string, grantees ...Grantee) *PutBucketACLRequest {
+	r.acl.addGrant(permission, grantees)
+	return r
+}
+
+// SetPolicy: 使用完整的AccessControlPolicy替换原有ACL, 需要包含Owner
+func (r *PutBucketACLRequest) SetPolicy(policy *AccessControlPolicy) *PutBucketACLRequest {
+	r.acl.policy = policy
+	return r
+}
+
+func (r *PutBucketACLRequest) Do(p *RequestParam) Response {
+	var pbaresp = &PutBucketACLResponse{}
+
+	// 参数校验
+	if p == nil {
+		pbaresp.err = errors.New("Nil RequestParam")
+		return pbaresp
+	}
+	if err := p.Validate(); err != nil {
+		pbaresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return pbaresp
+	}
+	if len(r.bucket) <= 0 {
+		pbaresp.err = errors.New("Empty bucket name")
+		return pbaresp
+	}
+
+	pbaresp.err = putACL(p, p.objectURL(r.bucket, "", "acl"), &r.acl)
+	return pbaresp
+}
+
+type PutBucketACLResponse struct {
+	err error
+}
+
+func (r PutBucketACLResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type GetObjACLRequest struct {
+	bucket  string // [required]
+	objName string // [required]
+
+	// [optional] 为空时获取最新版本的ACL
+	versionId string
+}
+
+func NewGetObjACLRequest(bucket, objName string) *GetObjACLRequest {
+	return &GetObjACLRequest{
+		bucket:  bucket,
+		objName: objName,
+	}
+}
+
+func (r *GetObjACLRequest) SetVersionId(versionId string) *GetObjACLRequest {
+	r.versionId = versionId
+	return r
+}
+
+func (r *GetObjACLRequest) Do(p *RequestParam) Response {
+	var goaresp = &GetObjACLResponse{}
+
+	// 参数校验
+	if p == nil {
+		goaresp.err = errors.New("Nil RequestParam")
+		return goaresp
+	}
+	if err := p.Validate(); err != nil {
+		goaresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return goaresp
+	}
+	if len(r.bucket) <= 0 || len(r.objName) <= 0 {
+		goaresp.err = errors.New("Empty bucket or object name")
+		return goaresp
+	}
+
+	url := p.objectURL(r.bucket, r.objName, objACLQuery(r.versionId))
+	goaresp.err = getACL(p, url, &goaresp.AccessControlPolicy)
+	return goaresp
+}
+
+type GetObjACLResponse struct {
+	AccessControlPolicy
+
+	err error
+}
+
+func (r GetObjACLResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type PutObjACLRequest struct {
+	bucket  string // [required]
+	objName string // [required]
+
+	// [optional] 为空时设置最新版本的ACL
+	versionId string
+
+	// [required] SetACL | SetGrant | SetPolicy至少设置一个
+	acl aclOption
+}
+
+func NewPutObjACLRequest(bucket, objName string) *PutObjACLRequest {
+	return &PutObjACLRequest{
+		bucket:  bucket,
+		objName: objName,
+	}
+}
+
+func (r *PutObjACLRequest) SetVersionId(versionId string) *PutObjACLRequest {
+	r.versionId = versionId
+	return r
+}
+
+// SetACL: 设置canned ACL, 比如ACLPublicRead
+func (r *PutObjACLRequest) SetACL(acl string) *PutObjACLRequest {
+	r.acl.setCanned(acl)
+	return r
+}
+
+// SetGrant: 通过x-amz-grant-*头授予grantees权限, 可以多次调用
+func (r *PutObjACLRequest) SetGrant(permission string, grantees ...Grantee) *PutObjACLRequest {
+	r.acl.addGrant(permission, grantees)
+	return r
+}
+
+// SetPolicy: 使用完整的AccessControlPolicy替换原有ACL, 需要包含Owner
+func (r *PutObjACLRequest) SetPolicy(policy *AccessControlPolicy) *PutObjACLRequest {
+	r.acl.policy = policy
+	return r
+}
+
+func (r *PutObjACLRequest) Do(p *RequestParam) Response {
+	var poaresp = &PutObjACLResponse{}
+
+	// 参数校验
+	if p == nil {
+		poaresp.err = errors.New("Nil RequestParam")
+		return poaresp
+	}
+	if err := p.Validate(); err != nil {
+		poaresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return poaresp
+	}
+	if len(r.bucket) <= 0 || len(r.objName) <= 0 {
+		poaresp.err = errors.New("Empty bucket or object name")
+		return poaresp
+	}
+
+	url := p.objectURL(r.bucket, r.objName, objACLQuery(r.versionId))
+	poaresp.err = putACL(p, url, &r.acl)
+	return poaresp
+}
+
+type PutObjACLResponse struct {
+	err error
+}
+
+func (r PutObjACLResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+func objACLQuery(versionId string) string {
+	if len(versionId) <= 0 {
+		return "acl"
+	}
+	query := url.Values{}
+	query.Set("versionId", versionId)
+	return "acl&" + query.Encode()
+}
+
+// getACL: GET ?acl并解析为AccessControlPolicy
+func getACL(p *RequestParam, url string, policy *AccessControlPolicy) error {
+	respBody, err := doSimpleGet(p, url)
+	if err != nil {
+		return err
+	}
+	if err = xml.Unmarshal(respBody, policy); err != nil {
+		return fmt.Errorf("Unmarshal response body err, %v", err)
+	}
+	return nil
+}
+
+// putACL: PUT ?acl, 设置了AccessControlPolicy时放在body中, 否则通过请求头设置
+func putACL(p *RequestParam, url string, acl *aclOption) error {
+	if err := acl.validate(); err != nil {
+		return err
+	}
+	if len(acl.canned) <= 0 && len(acl.grants) <= 0 && acl.policy == nil {
+		return errors.New("Empty ACL")
+	}
+
+	var body []byte
+	if acl.policy != nil {
+		b, err := xml.Marshal(acl.policy)
+		if err != nil {
+			return fmt.Errorf("Marshal AccessControlPolicy err, %v", err)
+		}
+		body = b
+	}
+
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("New http request err, %v", err)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	acl.setHeader(req.Header)
+	p.Sign(req, HexSHA256(body))
+
+	resp, err := p.do(req)
+	if err != nil {
+		return fmt.Errorf("Do request err, %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Read response body err, %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return newS3Error(resp, respBody)
+	}
+	return nil
+}
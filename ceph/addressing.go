@@ -0,0 +1,103 @@
+package ceph
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	AddressingPath        = 0 // scheme://host/bucket/object
+	AddressingVirtualHost = 1 // scheme://bucket.host/object, 需要ceph配置rgw_dns_name
+)
+
+// objectURL: 拼接访问bucket/objName的URL, bucket为空时访问服务根路径, objName为空时访问bucket
+// objName中的'%', '?', '#', 空格等字符会按照S3的规则编码, 保证发送的path与参与签名的一致
+// @param rawQuery: 已经编码的query参数, 可以为空
+func (p *RequestParam) objectURL(bucket, objName, rawQuery string) string {
+	host, path := p.objectLocation(bucket, objName)
+
+	u := &url.URL{
+		Scheme:   p.scheme(),
+		Host:     host,
+		Path:     path,
+		RawPath:  EncodePath(path),
+		RawQuery: rawQuery,
+	}
+	return u.String()
+}
+
+// objectLocation: 根据寻址方式返回访问bucket/objName使用的host和path
+func (p *RequestParam) objectLocation(bucket, objName string) (string, string) {
+	if p.useVirtualHost(bucket) {
+		return bucket + "." + p.Host, "/" + objName
+	}
+
+	switch {
+	case len(bucket) <= 0:
+		return p.Host, "/"
+	case len(objName) <= 0:
+		return p.Host, "/" + bucket
+	default:
+		return p.Host, "/" + bucket + "/" + objName
+	}
+}
+
+// useVirtualHost: bucket名不能作为域名或者Host是IP时退回到path方式
+func (p *RequestParam) useVirtualHost(bucket string) bool {
+	if p.Addressing != AddressingVirtualHost || !IsDNSCompatibleBucket(bucket) {
+		return false
+	}
+
+	hostname := p.Host
+	if h, _, err := net.SplitHostPort(p.Host); err == nil {
+		hostname = h
+	}
+	if net.ParseIP(hostname) != nil {
+		return false
+	}
+
+	// https的通配符证书只能匹配一级子域名
+	if p.scheme() == SchemeHTTPS && strings.Contains(bucket, ".") {
+		return false
+	}
+	return true
+}
+
+// canonicalResource: V2签名使用的资源路径, 与请求行中编码后的path一致
+// virtual host方式需要把bucket加回path前面
+func (p *RequestParam) canonicalResource(u *url.URL) string {
+	path := EncodePath(u.Path)
+	suffix := "." + p.Host
+	if u.Host != p.Host && strings.HasSuffix(u.Host, suffix) {
+		return "/" + strings.TrimSuffix(u.Host, suffix) + path
+	}
+	return path
+}
+
+// IsDNSCompatibleBucket: bucket名是否可以作为域名的一部分
+// 3~63个字符, 只包含小写字母、数字、'-'和'.', 以字母或数字开头和结尾, 且不能是IP
+func IsDNSCompatibleBucket(bucket string) bool {
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return false
+	}
+	if net.ParseIP(bucket) != nil {
+		return false
+	}
+
+	for _, label := range strings.Split(bucket, ".") {
+		if len(label) <= 0 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z':
+			case c >= '0' && c <= '9':
+			case c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -25,6 +25,7 @@ func init() {
 	QsaOfInterest["requestPayment"] = struct{}{}
 	QsaOfInterest["torrent"] = struct{}{}
 	QsaOfInterest["versioning"] = struct{}{}
+	QsaOfInterest["versionId"] = struct{}{}
 	QsaOfInterest["versions"] = struct{}{}
 	QsaOfInterest["website"] = struct{}{}
 	QsaOfInterest["uploads"] = struct{}{}
@@ -44,13 +45,38 @@ func init() {
 	QsaOfInterest["compose"] = struct{}{}
 }
 
+// Sign: 按照p.SignVersion对请求签名，设置Authorization头
+// @param payloadHash: 仅V4签名使用, body的sha256(hex)或者UnsignedPayload | StreamingPayload
+// @return: 签名值, V4流式上传时作为第一个chunk的seed signature
+// Sign应该在设置完http头后调用(除了Authorization)
+func (p RequestParam) Sign(r *http.Request, payloadHash string) string {
+	if p.SignVersion == SignV4 {
+		return SignatureV4(p.AccessKey, p.SecretKey, p.Region, r, payloadHash, p.now())
+	}
+
+	sign := signatureV2(p.SecretKey, r, p.canonicalResource(r.URL), "")
+	r.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, sign))
+	return sign
+}
+
 // @param secretKey: 签名的Key
 // @param method: HTTP请求的method，取值"PUT" | "POST" | "GET"
 // Signature应该在设置完http头后调用(除了Authorization)
+// 请求头中的Expires会替换Date参与签名, 仅用于生成带签名的URL
 func Signature(secretKey string, r *http.Request) string {
+	return signatureV2(secretKey, r, EncodePath(r.URL.Path), r.Header.Get("Expires"))
+}
+
+// signatureV2: resource为参与签名的资源路径, virtual host方式时需要包含bucket
+// expires不为空时替换date参与签名(带签名的URL), 此时请求头中的Expires不参与签名
+func signatureV2(secretKey string, r *http.Request, resource, expires string) string {
 	var (
 		h          = make(map[string]string)
 		sortedKeys = make([]string, 0)
+
+		// x-amz-*头需要以"key:value"的形式参与签名
+		amzHeaders    = make(map[string]string)
+		sortedAmzKeys = make([]string, 0)
 	)
 
 	for k, v := range r.Header {
@@ -59,8 +85,15 @@ func Signature(secretKey string, r *http.Request) string {
 		case "date", "content-type", "content-md5":
 			h[lowerKey] = strings.Join(v, " ")
 			sortedKeys = append(sortedKeys, lowerKey)
-		case "expires":
-			h[lowerKey] = strings.Join(v, " ")
+		default:
+			if strings.HasPrefix(lowerKey, "x-amz-") {
+				vals := make([]string, 0, len(v))
+				for _, vv := range v {
+					vals = append(vals, strings.TrimSpace(vv))
+				}
+				amzHeaders[lowerKey] = strings.Join(vals, ",")
+				sortedAmzKeys = append(sortedAmzKeys, lowerKey)
+			}
 		}
 	}
 
@@ -77,20 +110,28 @@ func Signature(secretKey string, r *http.Request) string {
 		h["content-type"] = ""
 		sortedKeys = append(sortedKeys, "content-type")
 	}
-	if v, ok := h["expires"]; ok {
+	if _, ok := amzHeaders["x-amz-date"]; ok {
+		// x-amz-date会作为x-amz-*头参与签名，date置空
+		h["date"] = ""
+	}
+	if len(expires) > 0 {
 		// 如果有设置expires时间，则用其替换date
-		h["date"] = v
+		h["date"] = expires
 		// no need to append again
 	}
 
 	// 所有header按照key排序
 	sort.Strings(sortedKeys)
+	sort.Strings(sortedAmzKeys)
 
 	canonical := r.Method + "\n"
 	for _, k := range sortedKeys {
 		// 仅添加请求头的值
 		canonical += h[k] + "\n"
 	}
+	for _, k := range sortedAmzKeys {
+		canonical += k + ":" + amzHeaders[k] + "\n"
+	}
 
 	// 对uri进行排序，过滤
 	var (
@@ -115,11 +156,16 @@ func Signature(secretKey string, r *http.Request) string {
 			continue
 		}
 		for _, v := range queryVal {
+			if len(v) <= 0 {
+				// url.Values会把xxx?acl解析为acl=""
+				newQuerySlice = append(newQuerySlice, k)
+				continue
+			}
 			newQuerySlice = append(newQuerySlice, fmt.Sprintf("%s=%s", k, v))
 		}
 	}
 
-	canonical += url.Path
+	canonical += resource
 	if len(newQuerySlice) > 0 {
 		canonical += "?" + strings.Join(newQuerySlice, "&")
 	}
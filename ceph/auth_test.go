@@ -0,0 +1,66 @@
+package ceph
+
+import (
+	"net/http"
+	"testing"
+)
+
+// 用例来自S3文档中V2签名的示例
+func TestSignatureV2(t *testing.T) {
+	const secretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+
+	cases := []struct {
+		name      string
+		method    string
+		url       string
+		resource  string
+		header    [][2]string
+		signature string
+	}{
+		{
+			name:     "object-get",
+			method:   "GET",
+			url:      "http://johnsmith.s3.amazonaws.com/photos/puppy.jpg",
+			resource: "/johnsmith/photos/puppy.jpg",
+			header: [][2]string{
+				{"Date", "Tue, 27 Mar 2007 19:36:42 +0000"},
+			},
+			signature: "bWq2s1WEIj+Ydj0vQ697zp+IXMU=",
+		},
+		{
+			// x-amz-*头小写排序, 同名的多个值用','连接, 其他头不参与签名
+			name:     "upload-amz-headers",
+			method:   "PUT",
+			url:      "http://static.johnsmith.net:8080/db-backup.dat.gz",
+			resource: "/static.johnsmith.net/db-backup.dat.gz",
+			header: [][2]string{
+				{"Date", "Tue, 27 Mar 2007 21:06:08 +0000"},
+				{"x-amz-acl", "public-read"},
+				{"content-type", "application/x-download"},
+				{"Content-MD5", "4gJE4saaMU4BqNR0kLY+lw=="},
+				{"X-Amz-Meta-ReviewedBy", "joe@johnsmith.net"},
+				{"X-Amz-Meta-ReviewedBy", "jane@johnsmith.net"},
+				{"X-Amz-Meta-FileChecksum", "0x02661779"},
+				{"X-Amz-Meta-ChecksumAlgorithm", "crc32"},
+				{"Content-Disposition", "attachment; filename=database.dat"},
+				{"Content-Encoding", "gzip"},
+				{"Content-Length", "5913339"},
+			},
+			signature: "ilyl83RwaSoYIEdixDQcA4OnAnc=",
+		},
+	}
+
+	for _, c := range cases {
+		r, err := http.NewRequest(c.method, c.url, nil)
+		if err != nil {
+			t.Fatalf("%s: New http request err, %v", c.name, err)
+		}
+		for _, kv := range c.header {
+			r.Header.Add(kv[0], kv[1])
+		}
+
+		if sig := signatureV2(secretKey, r, c.resource, ""); sig != c.signature {
+			t.Errorf("%s: signature %s, want %s", c.name, sig, c.signature)
+		}
+	}
+}
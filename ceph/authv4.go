@@ -0,0 +1,341 @@
+package ceph
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 签名版本
+const (
+	SignV2 = 2
+	SignV4 = 4
+)
+
+// V4签名时请求body的处理方式
+const (
+	PayloadUnsigned  = 0 // 不对body签名, x-amz-content-sha256为UNSIGNED-PAYLOAD
+	PayloadSigned    = 1 // 计算整个body的sha256参与签名
+	PayloadStreaming = 2 // aws-chunked方式分块签名
+)
+
+const (
+	SignV4Algorithm    = "AWS4-HMAC-SHA256"
+	StreamingAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+
+	UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	StreamingPayload   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	EmptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	DefaultRegion             = "us-east-1"
+	DefaultStreamingChunkSize = 64 * 1024
+
+	iso8601Format = "20060102T150405Z"
+	yyyymmdd      = "20060102"
+	serviceS3     = "s3"
+)
+
+// 不参与V4签名的头, 这些头可能会被http库或代理修改
+var ignoredV4Headers = map[string]struct{}{
+	"authorization":   struct{}{},
+	"user-agent":      struct{}{},
+	"accept-encoding": struct{}{},
+	"content-length":  struct{}{},
+	"expect":          struct{}{},
+}
+
+// SignatureV4: 对r进行V4签名, 设置X-Amz-Date, X-Amz-Content-Sha256和Authorization头
+// @param payloadHash: body的sha256(hex)，或者UnsignedPayload | StreamingPayload
+// @return: 签名值(hex)，流式上传时作为第一个chunk的seed signature
+// SignatureV4应该在设置完http头后调用(除了Authorization)
+func SignatureV4(accessKey, secretKey, region string, r *http.Request, payloadHash string, t time.Time) string {
+	if len(region) <= 0 {
+		region = DefaultRegion
+	}
+	if len(payloadHash) <= 0 {
+		payloadHash = UnsignedPayload
+	}
+
+	t = t.UTC()
+	amzDate := t.Format(iso8601Format)
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 保证发送出去的path和query与参与签名的一致
+	r.URL.RawPath = EncodePath(r.URL.Path)
+	r.URL.RawQuery = canonicalQueryV4(r.URL.Query())
+
+	signedHeaders, canonicalHeaders := canonicalHeadersV4(r)
+	signature := signV4(secretKey, region, serviceS3, r, signedHeaders, canonicalHeaders, payloadHash, t)
+	scope := credentialScope(t, region, serviceS3)
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		SignV4Algorithm, accessKey, scope, signedHeaders, signature))
+
+	return signature
+}
+
+// PresignV4: 生成V4签名的URL，签名信息放在query中，body不参与签名
+// r中设置的头都会参与签名，使用URL时必需带上相同的头
+// @param expired: 有效时间，单位秒，取值[1, 604800]
+func PresignV4(accessKey, secretKey, region string, r *http.Request, expired int64, t time.Time) string {
+	if len(region) <= 0 {
+		region = DefaultRegion
+	}
+
+	t = t.UTC()
+	signedHeaders, canonicalHeaders := canonicalHeadersV4(r)
+
+	query := r.URL.Query()
+	query.Del("X-Amz-Signature")
+	query.Set("X-Amz-Algorithm", SignV4Algorithm)
+	query.Set("X-Amz-Credential", accessKey+"/"+credentialScope(t, region, serviceS3))
+	query.Set("X-Amz-Date", t.Format(iso8601Format))
+	query.Set("X-Amz-Expires", strconv.FormatInt(expired, 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	r.URL.RawPath = EncodePath(r.URL.Path)
+	r.URL.RawQuery = canonicalQueryV4(query)
+
+	signature := signV4(secretKey, region, serviceS3, r, signedHeaders, canonicalHeaders, UnsignedPayload, t)
+	r.URL.RawQuery += "&X-Amz-Signature=" + signature
+
+	return r.URL.String()
+}
+
+// signV4: 按照r当前的path和query计算V4签名, service对于S3固定为"s3"
+func signV4(secretKey, region, service string, r *http.Request, signedHeaders, canonicalHeaders, payloadHash string, t time.Time) string {
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.RawPath,
+		r.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		SignV4Algorithm,
+		t.Format(iso8601Format),
+		credentialScope(t, region, service),
+		HexSHA256([]byte(canonical)),
+	}, "\n")
+
+	return hex.EncodeToString(Hmac256([]byte(stringToSign), signingKey(secretKey, t, region, service)))
+}
+
+func credentialScope(t time.Time, region, service string) string {
+	return strings.Join([]string{t.Format(yyyymmdd), region, service, "aws4_request"}, "/")
+}
+
+func signingKey(secretKey string, t time.Time, region, service string) []byte {
+	k := Hmac256([]byte(t.Format(yyyymmdd)), []byte("AWS4"+secretKey))
+	k = Hmac256([]byte(region), k)
+	k = Hmac256([]byte(service), k)
+	k = Hmac256([]byte("aws4_request"), k)
+	return k
+}
+
+func canonicalHeadersV4(r *http.Request) (signedHeaders, canonicalHeaders string) {
+	var (
+		h          = make(map[string]string)
+		sortedKeys = make([]string, 0)
+	)
+
+	host := r.Host
+	if len(host) <= 0 {
+		host = r.URL.Host
+	}
+	h["host"] = host
+	sortedKeys = append(sortedKeys, "host")
+
+	for k, v := range r.Header {
+		lowerKey := strings.ToLower(k)
+		if _, ok := ignoredV4Headers[lowerKey]; ok || lowerKey == "host" {
+			continue
+		}
+		vals := make([]string, 0, len(v))
+		for _, vv := range v {
+			vals = append(vals, strings.Join(strings.Fields(vv), " "))
+		}
+		h[lowerKey] = strings.Join(vals, ",")
+		sortedKeys = append(sortedKeys, lowerKey)
+	}
+	sort.Strings(sortedKeys)
+
+	buf := bytes.NewBuffer(nil)
+	for _, k := range sortedKeys {
+		buf.WriteString(k)
+		buf.WriteString(":")
+		buf.WriteString(h[k])
+		buf.WriteString("\n")
+	}
+
+	return strings.Join(sortedKeys, ";"), buf.String()
+}
+
+func canonicalQueryV4(query url.Values) string {
+	sortedKeys := make([]string, 0, len(query))
+	for k := range query {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	pairs := make([]string, 0, len(query))
+	for _, k := range sortedKeys {
+		// 对于xxx?acl这种情况，值为空字符串
+		vals := append([]string(nil), query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			pairs = append(pairs, EncodeURI(k, true)+"="+EncodeURI(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// EncodePath: 按照S3的规则对path进行编码, 保留'/'
+func EncodePath(path string) string {
+	if len(path) <= 0 {
+		return "/"
+	}
+	return EncodeURI(path, false)
+}
+
+// EncodeURI: 除了A-Z, a-z, 0-9, '-', '.', '_', '~'外全部进行%XY编码
+// @param encodeSlash: 是否编码'/'
+func EncodeURI(s string, encodeSlash bool) string {
+	buf := bytes.NewBuffer(nil)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+			buf.WriteByte(c)
+		case c == '-', c == '.', c == '_', c == '~':
+			buf.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			buf.WriteByte(c)
+		default:
+			buf.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return buf.String()
+}
+
+func Hmac256(msg, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func HexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+//////////////////////////////////////////////////////////////////
+// StreamingReader: 把src按照aws-chunked格式分块，每个chunk都带上签名
+// 用于x-amz-content-sha256为STREAMING-AWS4-HMAC-SHA256-PAYLOAD的上传
+type StreamingReader struct {
+	src       io.Reader
+	secretKey string
+	region    string
+	t         time.Time
+	prevSig   string
+	chunkSize int
+
+	chunk []byte
+	buf   bytes.Buffer
+	done  bool
+}
+
+// @param amzDate : 请求头中X-Amz-Date的值
+// @param seedSig : SignatureV4返回的请求签名
+func NewStreamingReader(src io.Reader, secretKey, region, amzDate, seedSig string) (*StreamingReader, error) {
+	t, err := time.Parse(iso8601Format, amzDate)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid X-Amz-Date %s, %v", amzDate, err)
+	}
+	if len(region) <= 0 {
+		region = DefaultRegion
+	}
+	return &StreamingReader{
+		src:       src,
+		secretKey: secretKey,
+		region:    region,
+		t:         t,
+		prevSig:   seedSig,
+		chunkSize: DefaultStreamingChunkSize,
+		chunk:     make([]byte, DefaultStreamingChunkSize),
+	}, nil
+}
+
+func (r *StreamingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() <= 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		r.writeChunk(r.chunk[:n])
+
+		// 最后需要发送一个长度为0的chunk表示结束
+		if n <= 0 {
+			r.done = true
+		} else if err != nil {
+			r.writeChunk(nil)
+			r.done = true
+		}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *StreamingReader) writeChunk(data []byte) {
+	stringToSign := strings.Join([]string{
+		StreamingAlgorithm,
+		r.t.Format(iso8601Format),
+		credentialScope(r.t, r.region, serviceS3),
+		r.prevSig,
+		EmptyPayloadSHA256,
+		HexSHA256(data),
+	}, "\n")
+	sig := hex.EncodeToString(Hmac256([]byte(stringToSign), signingKey(r.secretKey, r.t, r.region, serviceS3)))
+	r.prevSig = sig
+
+	r.buf.WriteString(fmt.Sprintf("%x;chunk-signature=%s\r\n", len(data), sig))
+	r.buf.Write(data)
+	r.buf.WriteString("\r\n")
+}
+
+// StreamingContentLength: 计算aws-chunked编码后的Content-Length
+// @param dataLen: 原始数据长度, 即X-Amz-Decoded-Content-Length
+func StreamingContentLength(dataLen int64) int64 {
+	chunkLen := func(n int64) int64 {
+		// hex(n) + ";chunk-signature=" + 64字节签名 + "\r\n" + data + "\r\n"
+		return int64(len(fmt.Sprintf("%x", n))) + 17 + 64 + 2 + n + 2
+	}
+
+	var (
+		size = int64(DefaultStreamingChunkSize)
+		full = dataLen / size
+		last = dataLen % size
+	)
+
+	total := full * chunkLen(size)
+	if last > 0 {
+		total += chunkLen(last)
+	}
+	total += chunkLen(0)
+	return total
+}
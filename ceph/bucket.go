@@ -2,12 +2,17 @@ package ceph
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -16,14 +21,107 @@ var (
 
 ////////////////////////////////////////////////////////////
 type RequestParam struct {
-	Host      string //ip:port
+	Scheme     string // SchemeHTTP | SchemeHTTPS, 为空时按SchemeHTTP处理
+	Host       string // ip:port | domain:port, 省略port时使用scheme的默认端口
+	Addressing int    // AddressingPath | AddressingVirtualHost
+
 	AccessKey string
 	SecretKey string
+
+	SignVersion int    // SignV2 | SignV4, 为0时按SignV2处理
+	Region      string // V4签名使用
+	PayloadMode int    // V4签名时上传请求body的签名方式
+
+	// 发送请求使用的http.Client, 为nil时使用http.DefaultClient
+	Client *http.Client
+	// 重试策略, 为nil时不重试
+	Retry *RetryPolicy
+
+	// 与服务端的时间偏差, 为nil时不做校正
+	skew *clockSkew
+
+	// 请求使用的context, 为nil时使用context.Background()
+	ctx context.Context
+}
+
+// Context: 返回请求使用的context, 未设置时返回context.Background()
+func (p *RequestParam) Context() context.Context {
+	if p.ctx != nil {
+		return p.ctx
+	}
+	return context.Background()
+}
+
+// validateHost: host可以是ip或者域名, 不在这里做DNS解析
+func validateHost(host string) error {
+	hostname := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("Invalid port in host %s", host)
+		}
+		hostname = h
+	}
+	if len(hostname) <= 0 || strings.ContainsAny(hostname, "/?#@ ") {
+		return fmt.Errorf("Invalid host %s", host)
+	}
+	return nil
+}
+
+func (p *RequestParam) scheme() string {
+	if len(p.Scheme) <= 0 {
+		return SchemeHTTP
+	}
+	return p.Scheme
+}
+
+// do: 使用p.Client发送请求, 按照p.Retry重试
+// 服务端返回RequestTimeTooSkewed时校正时间偏差, 重新签名后再发送一次
+func (p *RequestParam) do(req *http.Request) (*http.Response, error) {
+	resp, err := p.send(req)
+	if err != nil || !p.checkClockSkew(resp) {
+		return resp, err
+	}
+
+	next, resignErr := p.resign(req)
+	if resignErr != nil {
+		return resp, err
+	}
+	resp.Body.Close()
+	return p.send(next)
+}
+
+func (p *RequestParam) send(req *http.Request) (*http.Response, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if p.Retry == nil || p.Retry.MaxAttempts <= 1 {
+		return client.Do(req)
+	}
+	return p.Retry.doWithRetry(client, req)
+}
+
+// cleanup: 用于失败后的清理请求(比如终止分块上传), ctx已经取消时改用context.Background()
+func (p *RequestParam) cleanup() *RequestParam {
+	if p.Context().Err() == nil {
+		return p
+	}
+	return p.WithContext(context.Background())
+}
+
+// WithContext: 返回使用ctx的浅拷贝, 用于取消请求或者设置超时
+func (p *RequestParam) WithContext(ctx context.Context) *RequestParam {
+	if ctx == nil {
+		panic("nil context")
+	}
+	p2 := *p
+	p2.ctx = ctx
+	return &p2
 }
 
 func (p RequestParam) Validate() error {
-	if _, err := net.ResolveTCPAddr("tcp", p.Host); err != nil {
-		return errors.New("Invalid host")
+	if err := validateHost(p.Host); err != nil {
+		return err
 	}
 
 	if len(p.AccessKey) <= 0 {
@@ -34,6 +132,30 @@ func (p RequestParam) Validate() error {
 		return errors.New("Empty SecretKey")
 	}
 
+	switch p.Scheme {
+	case "", SchemeHTTP, SchemeHTTPS:
+	default:
+		return fmt.Errorf("Unknown Scheme %s", p.Scheme)
+	}
+
+	switch p.Addressing {
+	case AddressingPath, AddressingVirtualHost:
+	default:
+		return fmt.Errorf("Unknown Addressing %d", p.Addressing)
+	}
+
+	switch p.SignVersion {
+	case 0, SignV2, SignV4:
+	default:
+		return fmt.Errorf("Unknown SignVersion %d", p.SignVersion)
+	}
+
+	switch p.PayloadMode {
+	case PayloadUnsigned, PayloadSigned, PayloadStreaming:
+	default:
+		return fmt.Errorf("Unknown PayloadMode %d", p.PayloadMode)
+	}
+
 	return nil
 }
 
@@ -55,6 +177,23 @@ type Bucket struct {
 	CreationDate string   `xml:"CreationDate"`
 }
 
+// Object: 列举bucket时返回的对象信息
+type Object struct {
+	XMLName      xml.Name  `xml:"Contents"`
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"` // 已去除两边的引号
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+	Owner        Owner     `xml:"Owner"`
+}
+
+// CommonPrefix: 设置了delimiter时，被合并的"目录"
+type CommonPrefix struct {
+	XMLName xml.Name `xml:"CommonPrefixes"`
+	Prefix  string   `xml:"Prefix"`
+}
+
 /////////////////////////////////////////////////////////////
 type GetAllBucketsRequest struct {
 }
@@ -77,20 +216,20 @@ func (r *GetAllBucketsRequest) Do(p *RequestParam) Response {
 	}
 
 	// 发送请求
-	url := fmt.Sprintf("http://%s/", p.Host)
-	req, err := http.NewRequest("GET", url, nil)
+	url := p.objectURL("", "", "")
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
 	if err != nil {
 		gabresp.err = fmt.Errorf("New http request err, %v", err)
 		return gabresp
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, Signature(p.SecretKey, req)))
+	p.Sign(req, EmptyPayloadSHA256)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
-		gabresp.err = fmt.Errorf("Do request err, %v", err)
+		gabresp.err = fmt.Errorf("Do request err, %w", err)
 		return gabresp
 	}
 	defer resp.Body.Close()
@@ -103,7 +242,7 @@ func (r *GetAllBucketsRequest) Do(p *RequestParam) Response {
 	}
 
 	if resp.StatusCode != 200 {
-		gabresp.err = errors.New(string(respBody))
+		gabresp.err = newS3Error(resp, respBody)
 		return gabresp
 	}
 
@@ -145,13 +284,13 @@ func (p GetBucketOption) UrlStr() string {
 	buf := bytes.NewBuffer(nil)
 	buf.WriteString(fmt.Sprintf("max-keys=%d", p.Maxkeys))
 	if len(p.Prefix) > 0 {
-		buf.WriteString(fmt.Sprintf("&prefix=%s", p.Prefix))
+		buf.WriteString(fmt.Sprintf("&prefix=%s", url.QueryEscape(p.Prefix)))
 	}
 	if len(p.Delimiter) > 0 {
-		buf.WriteString(fmt.Sprintf("&delimiter=%s", p.Delimiter))
+		buf.WriteString(fmt.Sprintf("&delimiter=%s", url.QueryEscape(p.Delimiter)))
 	}
 	if len(p.Marker) > 0 {
-		buf.WriteString(fmt.Sprintf("&marker=%s", p.Marker))
+		buf.WriteString(fmt.Sprintf("&marker=%s", url.QueryEscape(p.Marker)))
 	}
 	return buf.String()
 }
@@ -198,7 +337,7 @@ func (r *GetBucketRequest) Do(p *RequestParam) Response {
 	if r.validate {
 		result := NewHeadBucketRequest(r.bucket).Do(p)
 		if err := result.Err(); err != nil {
-			gbresp.err = fmt.Errorf("Validate bucket(%s) err, %v", r.bucket, err)
+			gbresp.err = fmt.Errorf("Validate bucket(%s) err, %w", r.bucket, err)
 			return gbresp
 		}
 		if result.(*HeadBucketResponse).IsExisted == false {
@@ -212,20 +351,20 @@ func (r *GetBucketRequest) Do(p *RequestParam) Response {
 	}
 
 	// 请求获取
-	url := fmt.Sprintf("http://%s/%s?%s", p.Host, r.bucket, r.opt.UrlStr())
-	req, err := http.NewRequest("GET", url, nil)
+	url := p.objectURL(r.bucket, "", r.opt.UrlStr())
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
 	if err != nil {
 		gbresp.err = fmt.Errorf("New http request err, %v", err)
 		return gbresp
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, Signature(p.SecretKey, req)))
+	p.Sign(req, EmptyPayloadSHA256)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
-		gbresp.err = fmt.Errorf("Do request err, %v", err)
+		gbresp.err = fmt.Errorf("Do request err, %w", err)
 		return gbresp
 	}
 	defer resp.Body.Close()
@@ -239,7 +378,7 @@ func (r *GetBucketRequest) Do(p *RequestParam) Response {
 	//fmt.Printf("Response: %s\n", string(respBody))
 
 	if resp.StatusCode != 200 {
-		gbresp.err = errors.New(string(respBody))
+		gbresp.err = newS3Error(resp, respBody)
 		return gbresp
 	}
 
@@ -247,24 +386,202 @@ func (r *GetBucketRequest) Do(p *RequestParam) Response {
 		gbresp.err = fmt.Errorf("Unmarshal response body err, %v", err)
 		return gbresp
 	}
+	for i := range gbresp.Contents {
+		gbresp.Contents[i].ETag = strings.Trim(gbresp.Contents[i].ETag, "\"")
+	}
+
+	// 没有设置delimiter时服务端不返回NextMarker，使用最后一个key作为下一页的marker
+	if gbresp.IsTruncated && len(gbresp.NextMarker) <= 0 {
+		gbresp.NextMarker = gbresp.lastKey()
+	}
 	return gbresp
 }
 
 type GetBucketResponse struct {
-	XMLName     xml.Name `xml:"ListBucketResult"`
-	Name        string   `xml:"Name"`
-	Prefix      string   `xml:"Prefix"`
-	Marker      string   `xml:"Marker"`
-	MaxKeys     uint32   `xml:"MaxKeys"`
-	IsTruncated bool     `xml:"IsTruncated"`
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Delimiter      string         `xml:"Delimiter"`
+	Marker         string         `xml:"Marker"`
+	NextMarker     string         `xml:"NextMarker"`
+	MaxKeys        uint32         `xml:"MaxKeys"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []Object       `xml:"Contents"`
+	CommonPrefixes []CommonPrefix `xml:"CommonPrefixes"`
 
 	err error
 }
 
+// lastKey: 返回本页中字典序最大的key或者prefix
+func (r GetBucketResponse) lastKey() string {
+	var last string
+	if n := len(r.Contents); n > 0 {
+		last = r.Contents[n-1].Key
+	}
+	if n := len(r.CommonPrefixes); n > 0 && r.CommonPrefixes[n-1].Prefix > last {
+		last = r.CommonPrefixes[n-1].Prefix
+	}
+	return last
+}
+
 func (r GetBucketResponse) Err() error {
 	return r.err
 }
 
+////////////////////////////////////////////////////////////////////////
+// ListObjectsV2Option: ListObjectsV2(list-type=2)的参数
+type ListObjectsV2Option struct {
+	Prefix            string
+	Delimiter         string
+	ContinuationToken string // 上一页返回的NextContinuationToken
+	StartAfter        string // 从该key之后开始列举，仅第一页有效
+	FetchOwner        bool   // V2默认不返回Owner
+	Maxkeys           uint32
+}
+
+func DefaultListObjectsV2Option() *ListObjectsV2Option {
+	return &ListObjectsV2Option{
+		Maxkeys: 1000,
+	}
+}
+
+func (p ListObjectsV2Option) UrlStr() string {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(fmt.Sprintf("list-type=2&max-keys=%d", p.Maxkeys))
+	if len(p.Prefix) > 0 {
+		buf.WriteString(fmt.Sprintf("&prefix=%s", url.QueryEscape(p.Prefix)))
+	}
+	if len(p.Delimiter) > 0 {
+		buf.WriteString(fmt.Sprintf("&delimiter=%s", url.QueryEscape(p.Delimiter)))
+	}
+	if len(p.ContinuationToken) > 0 {
+		buf.WriteString(fmt.Sprintf("&continuation-token=%s", url.QueryEscape(p.ContinuationToken)))
+	}
+	if len(p.StartAfter) > 0 {
+		buf.WriteString(fmt.Sprintf("&start-after=%s", url.QueryEscape(p.StartAfter)))
+	}
+	if p.FetchOwner {
+		buf.WriteString("&fetch-owner=true")
+	}
+	return buf.String()
+}
+
+type ListObjectsV2Request struct {
+	bucket string               // [required]
+	opt    *ListObjectsV2Option // [optional]
+
+	// validate check if bucket is existed before getting, default is false
+	validate bool
+}
+
+func NewListObjectsV2Request(bucket string) *ListObjectsV2Request {
+	return &ListObjectsV2Request{
+		bucket:   bucket,
+		opt:      nil,
+		validate: false,
+	}
+}
+
+func (r *ListObjectsV2Request) SetOption(opt *ListObjectsV2Option) {
+	r.opt = opt
+}
+
+func (r *ListObjectsV2Request) SetValidate(v bool) {
+	r.validate = v
+}
+
+func (r *ListObjectsV2Request) Do(p *RequestParam) Response {
+	var lresp = &ListObjectsV2Response{}
+
+	// 参数校验
+	if p == nil {
+		lresp.err = errors.New("Nil RequestParam")
+		return lresp
+	}
+	if err := p.Validate(); err != nil {
+		lresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return lresp
+	}
+
+	// 验证bucket是否存在
+	if r.validate {
+		result := NewHeadBucketRequest(r.bucket).Do(p)
+		if err := result.Err(); err != nil {
+			lresp.err = fmt.Errorf("Validate bucket(%s) err, %w", r.bucket, err)
+			return lresp
+		}
+		if result.(*HeadBucketResponse).IsExisted == false {
+			lresp.err = ErrBucketNotExist
+			return lresp
+		}
+	}
+
+	if r.opt == nil {
+		r.opt = DefaultListObjectsV2Option()
+	}
+
+	// 请求获取
+	url := p.objectURL(r.bucket, "", r.opt.UrlStr())
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
+	if err != nil {
+		lresp.err = fmt.Errorf("New http request err, %v", err)
+		return lresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		lresp.err = fmt.Errorf("Do request err, %w", err)
+		return lresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		lresp.err = fmt.Errorf("Read response body err, %v", err)
+		return lresp
+	}
+
+	if resp.StatusCode != 200 {
+		lresp.err = newS3Error(resp, respBody)
+		return lresp
+	}
+
+	if err = xml.Unmarshal(respBody, lresp); err != nil {
+		lresp.err = fmt.Errorf("Unmarshal response body err, %v", err)
+		return lresp
+	}
+	for i := range lresp.Contents {
+		lresp.Contents[i].ETag = strings.Trim(lresp.Contents[i].ETag, "\"")
+	}
+	return lresp
+}
+
+type ListObjectsV2Response struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter"`
+	StartAfter            string         `xml:"StartAfter"`
+	ContinuationToken     string         `xml:"ContinuationToken"`
+	NextContinuationToken string         `xml:"NextContinuationToken"`
+	KeyCount              uint32         `xml:"KeyCount"`
+	MaxKeys               uint32         `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []Object       `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+
+	err error
+}
+
+func (r ListObjectsV2Response) Err() error {
+	return r.err
+}
+
 /////////////////////////////////////////////////////////////////
 type HeadBucketRequest struct {
 	bucket string // [required]
@@ -290,25 +607,33 @@ func (r *HeadBucketRequest) Do(p *RequestParam) Response {
 	}
 
 	// 发送请求
-	url := fmt.Sprintf("http://%s/%s/", p.Host, r.bucket)
-	req, err := http.NewRequest("HEAD", url, nil)
+	url := p.objectURL(r.bucket, "", "")
+	req, err := http.NewRequestWithContext(p.Context(), "HEAD", url, nil)
 	if err != nil {
 		hbresp.err = fmt.Errorf("New http request err, %v", err)
 		return hbresp
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, Signature(p.SecretKey, req)))
+	p.Sign(req, EmptyPayloadSHA256)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
-		hbresp.err = fmt.Errorf("Do request err, %v", err)
+		hbresp.err = fmt.Errorf("Do request err, %w", err)
 		return hbresp
 	}
 	defer resp.Body.Close()
 
-	hbresp.IsExisted = (resp.StatusCode == 200)
+	// 404表示bucket不存在, 其他状态码(比如403)返回错误
+	switch resp.StatusCode {
+	case 200:
+		hbresp.IsExisted = true
+	case 404:
+		hbresp.IsExisted = false
+	default:
+		hbresp.err = newS3Error(resp, nil)
+	}
 	return hbresp
 }
 
@@ -321,3 +646,375 @@ type HeadBucketResponse struct {
 func (r HeadBucketResponse) Err() error {
 	return r.err
 }
+
+/////////////////////////////////////////////////////////////////
+// canned ACL, 通过x-amz-acl头设置
+const (
+	ACLPrivate                = "private"
+	ACLPublicRead             = "public-read"
+	ACLPublicReadWrite        = "public-read-write"
+	ACLAuthenticatedRead      = "authenticated-read"
+	ACLBucketOwnerRead        = "bucket-owner-read"
+	ACLBucketOwnerFullControl = "bucket-owner-full-control"
+)
+
+type CreateBucketConfiguration struct {
+	XMLName            xml.Name `xml:"CreateBucketConfiguration"`
+	LocationConstraint string   `xml:"LocationConstraint"`
+}
+
+type CreateBucketRequest struct {
+	bucket string // [required]
+
+	// [optional] RGW中格式为"<zonegroup>:<placement-target>", 或者仅zonegroup
+	locationConstraint string
+	// [optional] canned ACL或者x-amz-grant-*
+	acl aclOption
+	// [optional] 是否开启object lock, 开启后bucket会自动开启多版本
+	objectLock bool
+}
+
+func NewCreateBucketRequest(bucket string) *CreateBucketRequest {
+	return &CreateBucketRequest{
+		bucket: bucket,
+	}
+}
+
+func (r *CreateBucketRequest) SetLocationConstraint(v string) *CreateBucketRequest {
+	r.locationConstraint = v
+	return r
+}
+
+// SetPlacement: 指定RGW的placement target
+// @param zonegroup : zonegroup的api name, 比如"default"
+// @param placement : placement target的id, 比如"default-placement"
+func (r *CreateBucketRequest) SetPlacement(zonegroup, placement string) *CreateBucketRequest {
+	r.locationConstraint = fmt.Sprintf("%s:%s", zonegroup, placement)
+	return r
+}
+
+func (r *CreateBucketRequest) SetACL(acl string) *CreateBucketRequest {
+	r.acl.setCanned(acl)
+	return r
+}
+
+// SetGrant: 通过x-amz-grant-*头授予grantees权限, 不能和SetACL同时使用
+func (r *CreateBucketRequest) SetGrant(permission string, grantees ...Grantee) *CreateBucketRequest {
+	r.acl.addGrant(permission, grantees)
+	return r
+}
+
+func (r *CreateBucketRequest) SetObjectLock(enable bool) *CreateBucketRequest {
+	r.objectLock = enable
+	return r
+}
+
+func (r *CreateBucketRequest) Do(p *RequestParam) Response {
+	var cbresp = &CreateBucketResponse{}
+
+	// 参数校验
+	if p == nil {
+		cbresp.err = errors.New("Nil RequestParam")
+		return cbresp
+	}
+	if err := p.Validate(); err != nil {
+		cbresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return cbresp
+	}
+	if len(r.bucket) <= 0 {
+		cbresp.err = errors.New("Empty bucket name")
+		return cbresp
+	}
+	if err := r.acl.validate(); err != nil {
+		cbresp.err = err
+		return cbresp
+	}
+
+	// 请求body
+	var body []byte
+	if len(r.locationConstraint) > 0 {
+		b, err := xml.Marshal(CreateBucketConfiguration{LocationConstraint: r.locationConstraint})
+		if err != nil {
+			cbresp.err = fmt.Errorf("Marshal CreateBucketConfiguration err, %v", err)
+			return cbresp
+		}
+		body = b
+	}
+
+	// 发送请求
+	url := p.objectURL(r.bucket, "", "")
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, bytes.NewReader(body))
+	if err != nil {
+		cbresp.err = fmt.Errorf("New http request err, %v", err)
+		return cbresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	r.acl.setHeader(req.Header)
+	if r.objectLock {
+		req.Header.Set("X-Amz-Bucket-Object-Lock-Enabled", "true")
+	}
+	p.Sign(req, HexSHA256(body))
+
+	resp, err := p.do(req)
+	if err != nil {
+		cbresp.err = fmt.Errorf("Do request err, %w", err)
+		return cbresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		cbresp.err = fmt.Errorf("Read response body err, %v", err)
+		return cbresp
+	}
+
+	if resp.StatusCode != 200 {
+		cbresp.err = newS3Error(resp, respBody)
+		return cbresp
+	}
+
+	cbresp.Location = resp.Header.Get("Location")
+	return cbresp
+}
+
+type CreateBucketResponse struct {
+	Location string
+
+	err error
+}
+
+func (r CreateBucketResponse) Err() error {
+	return r.err
+}
+
+/////////////////////////////////////////////////////////////////
+type DeleteBucketRequest struct {
+	bucket string // [required]
+
+	// 是否先清空bucket, 包括所有版本、删除标记以及未完成的分块上传
+	// 默认为false, 此时bucket非空会返回BucketNotEmpty错误
+	force bool
+}
+
+func NewDeleteBucketRequest(bucket string) *DeleteBucketRequest {
+	return &DeleteBucketRequest{
+		bucket: bucket,
+	}
+}
+
+func (r *DeleteBucketRequest) SetForce(force bool) *DeleteBucketRequest {
+	r.force = force
+	return r
+}
+
+func (r *DeleteBucketRequest) Do(p *RequestParam) Response {
+	var dbresp = &DeleteBucketResponse{}
+
+	// 参数校验
+	if p == nil {
+		dbresp.err = errors.New("Nil RequestParam")
+		return dbresp
+	}
+	if err := p.Validate(); err != nil {
+		dbresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return dbresp
+	}
+	if len(r.bucket) <= 0 {
+		dbresp.err = errors.New("Empty bucket name")
+		return dbresp
+	}
+
+	// 清空bucket
+	if r.force {
+		if err := abortAllUploads(p, r.bucket); err != nil {
+			dbresp.err = fmt.Errorf("Abort multipart uploads err, %w", err)
+			return dbresp
+		}
+		if err := deleteAllVersions(p, r.bucket); err != nil {
+			dbresp.err = fmt.Errorf("Delete objects err, %w", err)
+			return dbresp
+		}
+	}
+
+	// 发送请求
+	url := p.objectURL(r.bucket, "", "")
+	req, err := http.NewRequestWithContext(p.Context(), "DELETE", url, nil)
+	if err != nil {
+		dbresp.err = fmt.Errorf("New http request err, %v", err)
+		return dbresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		dbresp.err = fmt.Errorf("Do request err, %w", err)
+		return dbresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		dbresp.err = fmt.Errorf("Read response body err, %v", err)
+		return dbresp
+	}
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		dbresp.err = newS3Error(resp, respBody)
+		return dbresp
+	}
+
+	return dbresp
+}
+
+type DeleteBucketResponse struct {
+	err error
+}
+
+func (r DeleteBucketResponse) Err() error {
+	return r.err
+}
+
+/////////////////////////////////////////////////////////////////
+// 以下用于强制删除bucket时清空bucket
+
+type listVersionsResult struct {
+	XMLName             xml.Name        `xml:"ListVersionsResult"`
+	IsTruncated         bool            `xml:"IsTruncated"`
+	NextKeyMarker       string          `xml:"NextKeyMarker"`
+	NextVersionIdMarker string          `xml:"NextVersionIdMarker"`
+	Versions            []objectVersion `xml:"Version"`
+	DeleteMarkers       []objectVersion `xml:"DeleteMarker"`
+}
+
+type objectVersion struct {
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId"`
+}
+
+type listUploadsResult struct {
+	XMLName            xml.Name `xml:"ListMultipartUploadsResult"`
+	IsTruncated        bool     `xml:"IsTruncated"`
+	NextKeyMarker      string   `xml:"NextKeyMarker"`
+	NextUploadIdMarker string   `xml:"NextUploadIdMarker"`
+	Uploads            []struct {
+		Key      string `xml:"Key"`
+		UploadId string `xml:"UploadId"`
+	} `xml:"Upload"`
+}
+
+// deleteAllVersions: 删除bucket中所有对象的所有版本以及删除标记
+// 未开启多版本的bucket中对象的versionId为"null"
+func deleteAllVersions(p *RequestParam, bucket string) error {
+	var keyMarker, versionIdMarker string
+	for {
+		query := url.Values{}
+		query.Set("versions", "")
+		if len(keyMarker) > 0 {
+			query.Set("key-marker", keyMarker)
+		}
+		if len(versionIdMarker) > 0 {
+			query.Set("version-id-marker", versionIdMarker)
+		}
+
+		u := p.objectURL(bucket, "", query.Encode())
+		respBody, err := doSimpleGet(p, u)
+		if err != nil {
+			return err
+		}
+
+		var result listVersionsResult
+		if err = xml.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("Unmarshal response body err, %v", err)
+		}
+
+		dreq := NewDeleteObjsRequest(bucket).SetQuiet(true)
+		for _, v := range append(result.Versions, result.DeleteMarkers...) {
+			dreq.AddObj(v.Key, v.VersionId)
+		}
+		dresp := dreq.Do(p)
+		if err = dresp.Err(); err != nil {
+			return err
+		}
+		if errs := dresp.(*DeleteObjsResponse).Errors; len(errs) > 0 {
+			return errs[0]
+		}
+
+		if !result.IsTruncated {
+			return nil
+		}
+		keyMarker, versionIdMarker = result.NextKeyMarker, result.NextVersionIdMarker
+	}
+}
+
+// abortAllUploads: 终止bucket中所有未完成的分块上传
+func abortAllUploads(p *RequestParam, bucket string) error {
+	var keyMarker, uploadIdMarker string
+	for {
+		query := url.Values{}
+		query.Set("uploads", "")
+		if len(keyMarker) > 0 {
+			query.Set("key-marker", keyMarker)
+		}
+		if len(uploadIdMarker) > 0 {
+			query.Set("upload-id-marker", uploadIdMarker)
+		}
+
+		u := p.objectURL(bucket, "", query.Encode())
+		respBody, err := doSimpleGet(p, u)
+		if err != nil {
+			return err
+		}
+
+		var result listUploadsResult
+		if err = xml.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("Unmarshal response body err, %v", err)
+		}
+
+		for _, up := range result.Uploads {
+			aresp := NewAbortMultipartUploadRequest(bucket, up.Key, up.UploadId).Do(p)
+			if err = aresp.Err(); err != nil {
+				return fmt.Errorf("Abort %s(%s) err, %w", up.Key, up.UploadId, err)
+			}
+		}
+
+		if !result.IsTruncated {
+			return nil
+		}
+		keyMarker, uploadIdMarker = result.NextKeyMarker, result.NextUploadIdMarker
+	}
+}
+
+// doSimpleGet: 发送GET请求并读取完整的响应
+func doSimpleGet(p *RequestParam, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("New http request err, %v", err)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Do request err, %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Read response body err, %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, newS3Error(resp, respBody)
+	}
+	return respBody, nil
+}
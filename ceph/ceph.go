@@ -1,6 +1,13 @@
 package ceph
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 type Request interface {
 	Do(p *RequestParam) Response
@@ -11,22 +18,53 @@ type Response interface {
 }
 
 type Ceph struct {
-	IP   string
+	// SchemeHTTP | SchemeHTTPS, 默认SchemeHTTP
+	Scheme string
+	// ip或者域名
+	IP string
+	// <=0时使用scheme的默认端口
 	Port int
+	// AddressingPath | AddressingVirtualHost, 默认AddressingPath
+	Addressing int
 
 	AccessKey string
 	SecretKey string
+
+	// 签名版本, SignV2 | SignV4, 默认SignV2
+	SignVersion int
+	// V4签名使用的region, 默认us-east-1
+	Region string
+	// V4签名时上传请求body的签名方式, 默认PayloadUnsigned
+	PayloadMode int
+
+	// 所有请求共用的http.Client, 默认使用NewHTTPClient(nil)创建
+	Client *http.Client
+	// 所有请求共用的重试策略, 默认DefaultRetryPolicy(), 为nil时不重试
+	Retry *RetryPolicy
+
+	// 与服务端的时间偏差, 收到RequestTimeTooSkewed时自动更新
+	skew clockSkew
 }
 
 func NewCeph(ip string, port int, accessKey, secretKey string) *Ceph {
 	return &Ceph{
-		IP:        ip,
-		Port:      port,
-		AccessKey: accessKey,
-		SecretKey: secretKey,
+		Scheme:      SchemeHTTP,
+		IP:          ip,
+		Port:        port,
+		AccessKey:   accessKey,
+		SecretKey:   secretKey,
+		SignVersion: SignV2,
+		Region:      DefaultRegion,
+		PayloadMode: PayloadUnsigned,
+		Client:      NewHTTPClient(nil),
+		Retry:       DefaultRetryPolicy(),
 	}
 }
 
+func (c *Ceph) SetScheme(scheme string) {
+	c.Scheme = scheme
+}
+
 func (c *Ceph) SetIP(ip string) {
 	c.IP = ip
 }
@@ -35,6 +73,10 @@ func (c *Ceph) SetPort(port int) {
 	c.Port = port
 }
 
+func (c *Ceph) SetAddressing(addressing int) {
+	c.Addressing = addressing
+}
+
 func (c *Ceph) SetAccessKey(k string) {
 	c.AccessKey = k
 }
@@ -43,11 +85,95 @@ func (c *Ceph) SetSecretKey(k string) {
 	c.SecretKey = k
 }
 
+func (c *Ceph) SetSignVersion(v int) {
+	c.SignVersion = v
+}
+
+func (c *Ceph) SetRegion(region string) {
+	c.Region = region
+}
+
+func (c *Ceph) SetPayloadMode(mode int) {
+	c.PayloadMode = mode
+}
+
+func (c *Ceph) SetHTTPClient(client *http.Client) {
+	c.Client = client
+}
+
+// SetTransport: 使用rt发送请求, 比如调整过连接池的http.Transport或者测试用的RoundTripper
+func (c *Ceph) SetTransport(rt http.RoundTripper) {
+	c.Client = &http.Client{Transport: rt}
+}
+
+// EnableTLS: 使用https访问ceph, TLS配置由opt生成
+// c.Client使用的不是*http.Transport时返回错误, 此时需要自行在Transport上配置TLS
+func (c *Ceph) EnableTLS(opt *TLSOption) error {
+	tlsConfig, err := NewTLSConfig(opt)
+	if err != nil {
+		return err
+	}
+
+	if c.Client == nil {
+		c.Client = NewHTTPClient(nil)
+	}
+	var transport *http.Transport
+	switch rt := c.Client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = rt.Clone()
+	default:
+		return fmt.Errorf("Unsupported transport type %T, config TLS on it directly", rt)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	client := *c.Client
+	client.Transport = transport
+	c.Client = &client
+	c.Scheme = SchemeHTTPS
+	return nil
+}
+
+func (c *Ceph) SetRetryPolicy(policy *RetryPolicy) {
+	c.Retry = policy
+}
+
+// ClockOffset: 服务端时间减去本机时间的偏差, 签名时使用本机时间加上该偏差
+func (c *Ceph) ClockOffset() time.Duration {
+	return c.skew.get()
+}
+
+func (c *Ceph) SetClockOffset(d time.Duration) {
+	c.skew.set(d)
+}
+
 func (c *Ceph) Do(r Request) Response {
+	return c.DoContext(context.Background(), r)
+}
+
+// DoContext: 使用ctx执行请求, ctx取消或者超时后正在进行的传输会被中断
+func (c *Ceph) DoContext(ctx context.Context, r Request) Response {
 	p := &RequestParam{
-		Host:      fmt.Sprintf("%s:%d", c.IP, c.Port),
-		AccessKey: c.AccessKey,
-		SecretKey: c.SecretKey,
+		Scheme:      c.Scheme,
+		Host:        c.host(),
+		Addressing:  c.Addressing,
+		AccessKey:   c.AccessKey,
+		SecretKey:   c.SecretKey,
+		SignVersion: c.SignVersion,
+		Region:      c.Region,
+		PayloadMode: c.PayloadMode,
+		Client:      c.Client,
+		Retry:       c.Retry,
+		skew:        &c.skew,
+		ctx:         ctx,
 	}
 	return r.Do(p)
 }
+
+func (c *Ceph) host() string {
+	if c.Port <= 0 {
+		return c.IP
+	}
+	return net.JoinHostPort(c.IP, strconv.Itoa(c.Port))
+}
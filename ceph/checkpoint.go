@@ -0,0 +1,136 @@
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// 断点文件保存在源文件旁, 文件名为源文件名加上该后缀
+const UploadCheckpointSuffix = ".upload"
+
+// uploadCheckpoint: 分块上传的断点信息
+// 通过源文件的大小和修改时间判断文件是否发生变化
+type uploadCheckpoint struct {
+	Bucket      string         `json:"bucket"`
+	Object      string         `json:"object"`
+	UploadId    string         `json:"upload_id"`
+	PartSize    int64          `json:"part_size"`
+	FileSize    int64          `json:"file_size"`
+	FileModTime int64          `json:"file_mod_time"` // UnixNano
+	Parts       []CompletePart `json:"parts"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func newUploadCheckpoint(bucket, objName, filePath, uploadId string, partSize int64, stat os.FileInfo) *uploadCheckpoint {
+	return &uploadCheckpoint{
+		Bucket:      bucket,
+		Object:      objName,
+		UploadId:    uploadId,
+		PartSize:    partSize,
+		FileSize:    stat.Size(),
+		FileModTime: stat.ModTime().UnixNano(),
+		Parts:       make([]CompletePart, 0),
+		path:        filePath + UploadCheckpointSuffix,
+	}
+}
+
+// loadUploadCheckpoint: 加载并校验断点, 断点不可用时删除断点文件并返回nil
+// 源文件发生变化或者服务端已经没有该分块上传时, 会同时终止旧的分块上传
+// 已上传的分块通过ListParts校验, 只保留服务端存在且ETag一致的分块
+// ListParts的其他错误(超时、5xx等)不能说明断点失效, 保留断点文件并返回错误, 下次可以继续
+func loadUploadCheckpoint(p *RequestParam, bucket, objName, filePath string, stat os.FileInfo) (*uploadCheckpoint, error) {
+	path := filePath + UploadCheckpointSuffix
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+
+	cp := &uploadCheckpoint{}
+	if err = json.Unmarshal(b, cp); err != nil || cp.Bucket != bucket || cp.Object != objName || len(cp.UploadId) <= 0 {
+		os.Remove(path)
+		return nil, nil
+	}
+	cp.path = path
+
+	if cp.FileSize != stat.Size() || cp.FileModTime != stat.ModTime().UnixNano() {
+		NewAbortMultipartUploadRequest(bucket, objName, cp.UploadId).Do(p)
+		cp.remove()
+		return nil, nil
+	}
+
+	resp := NewListPartsRequest(bucket, objName, cp.UploadId).Do(p)
+	if err = resp.Err(); err != nil {
+		if ErrorCode(err) != ErrCodeNoSuchUpload {
+			return nil, fmt.Errorf("List parts of upload %s err, %w", cp.UploadId, err)
+		}
+		NewAbortMultipartUploadRequest(bucket, objName, cp.UploadId).Do(p)
+		cp.remove()
+		return nil, nil
+	}
+
+	uploaded := make(map[int]Part)
+	for _, part := range resp.(*ListPartsResponse).Parts {
+		uploaded[part.PartNumber] = part
+	}
+
+	parts := make([]CompletePart, 0, len(cp.Parts))
+	for _, part := range cp.Parts {
+		if up, ok := uploaded[part.PartNumber]; ok && up.ETag == part.ETag && up.Size == cp.partSize(part.PartNumber) {
+			parts = append(parts, part)
+		}
+	}
+	cp.Parts = parts
+
+	return cp, nil
+}
+
+// partSize: 计算指定分块的大小, 最后一个分块可能小于PartSize
+func (cp *uploadCheckpoint) partSize(partNumber int) int64 {
+	offset := int64(partNumber-1) * cp.PartSize
+	if offset+cp.PartSize > cp.FileSize {
+		return cp.FileSize - offset
+	}
+	return cp.PartSize
+}
+
+func (cp *uploadCheckpoint) addPart(part CompletePart) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.Parts = append(cp.Parts, part)
+	return cp.saveLocked()
+}
+
+func (cp *uploadCheckpoint) save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	return cp.saveLocked()
+}
+
+// saveLocked: 先写临时文件再rename, 避免进程崩溃时留下损坏的断点文件
+func (cp *uploadCheckpoint) saveLocked() error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("Marshal checkpoint err, %v", err)
+	}
+
+	tmpPath := cp.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+		return fmt.Errorf("Write checkpoint %s err, %v", tmpPath, err)
+	}
+	if err = os.Rename(tmpPath, cp.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Rename checkpoint err, %v", err)
+	}
+	return nil
+}
+
+func (cp *uploadCheckpoint) remove() {
+	os.Remove(cp.path)
+}
@@ -0,0 +1,104 @@
+package ceph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// MaxClockSkew: 服务端允许的最大时间偏差, 超过时返回RequestTimeTooSkewed
+const MaxClockSkew = 15 * time.Minute
+
+// clockSkew: 服务端时间减去本机时间的偏差, 同一个Ceph的所有请求共享
+type clockSkew struct {
+	offset int64 // time.Duration
+}
+
+func (c *clockSkew) get() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&c.offset))
+}
+
+func (c *clockSkew) set(d time.Duration) {
+	if c == nil {
+		return
+	}
+	atomic.StoreInt64(&c.offset, int64(d))
+}
+
+// now: 按照服务端时间校正后的当前时间
+func (p *RequestParam) now() time.Time {
+	return time.Now().Add(p.skew.get())
+}
+
+// date: 校正后的Date头
+func (p *RequestParam) date() string {
+	return p.now().UTC().Format(http.TimeFormat)
+}
+
+// checkClockSkew: 判断403是否由时间偏差导致, 是则根据响应的Date头更新时间偏差
+// 需要读取resp.Body判断错误码, 读取后会还原resp.Body
+func (p *RequestParam) checkClockSkew(resp *http.Response) bool {
+	if p.skew == nil || resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	offset := serverTime.Sub(time.Now())
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(body) > 0 {
+		var e S3Error
+		if xml.Unmarshal(body, &e) != nil || e.Code != ErrCodeRequestTimeTooSkewed {
+			return false
+		}
+	} else {
+		// HEAD没有body, 只能根据服务端时间判断
+		diff := offset - p.skew.get()
+		if diff > -MaxClockSkew && diff < MaxClockSkew {
+			return false
+		}
+	}
+
+	p.skew.set(offset)
+	return true
+}
+
+// resign: 时间偏差更新后使用校正后的时间重新签名
+// 流式上传的chunk签名依赖于原来的签名, 无法重新签名
+func (p *RequestParam) resign(req *http.Request) (*http.Request, error) {
+	if len(req.Header.Get("Authorization")) <= 0 {
+		return nil, errNotResignable
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == StreamingPayload {
+		return nil, errNotResignable
+	}
+
+	next, err := rewindRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if next == req {
+		next = req.Clone(req.Context())
+	}
+
+	if len(next.Header.Get("Date")) > 0 {
+		next.Header.Set("Date", p.date())
+	}
+	next.Header.Del("X-Amz-Date")
+	next.Header.Del("Authorization")
+	p.Sign(next, payloadHash)
+	return next, nil
+}
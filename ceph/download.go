@@ -0,0 +1,269 @@
+package ceph
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DefaultDownloadChunkSize = 16 * 1024 * 1024
+	DefaultDownloadWorkers   = 4
+)
+
+//////////////////////////////////////////////////////////////////
+// ParallelGetObjRequest: 把对象按Range拆分为多个分片并发下载到本地文件
+// 先通过GetObjInfoRequest获取对象大小并预分配文件，各分片使用WriteAt写入各自的位置
+// 分片请求带If-Range(ETag), 下载过程中对象被修改时返回错误
+type ParallelGetObjRequest struct {
+	bucket   string // [required]
+	objName  string // [required]
+	savePath string // [required]
+
+	// [optional] 每个分片的大小, 默认16MB
+	chunkSize int64
+	// [optional] 并发下载的分片数, 默认4
+	workers int
+	// [optional] 单个分片失败后的重试次数, 默认3
+	retries int
+
+	/* 以下内部使用 */
+	objSize        int64
+	enableProgress bool
+	progress       atomic.Value // [0,100] float64
+}
+
+func NewParallelGetObjRequest(bucket, objName, savePath string) *ParallelGetObjRequest {
+	return &ParallelGetObjRequest{
+		bucket:    bucket,
+		objName:   objName,
+		savePath:  savePath,
+		chunkSize: DefaultDownloadChunkSize,
+		workers:   DefaultDownloadWorkers,
+		retries:   DefaultPartRetries,
+	}
+}
+
+func (r *ParallelGetObjRequest) SetChunkSize(size int64) *ParallelGetObjRequest {
+	r.chunkSize = size
+	return r
+}
+
+func (r *ParallelGetObjRequest) SetWorkers(n int) *ParallelGetObjRequest {
+	r.workers = n
+	return r
+}
+
+func (r *ParallelGetObjRequest) SetRetries(n int) *ParallelGetObjRequest {
+	r.retries = n
+	return r
+}
+
+func (r *ParallelGetObjRequest) SetEnableProgress(enable bool) *ParallelGetObjRequest {
+	r.enableProgress = enable
+	r.progress.Store(float64(0))
+	return r
+}
+
+func (r *ParallelGetObjRequest) ObjSize() int64 {
+	return r.objSize
+}
+
+func (r *ParallelGetObjRequest) Progress() float64 {
+	v := r.progress.Load()
+	return v.(float64)
+}
+
+func (r *ParallelGetObjRequest) Do(p *RequestParam) Response {
+	var pgresp = &ParallelGetObjResponse{}
+
+	// 参数校验
+	if p == nil {
+		pgresp.err = errors.New("Nil RequestParam")
+		return pgresp
+	}
+	if err := p.Validate(); err != nil {
+		pgresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return pgresp
+	}
+	if r.chunkSize <= 0 {
+		pgresp.err = fmt.Errorf("Invalid chunk size %d", r.chunkSize)
+		return pgresp
+	}
+	if r.workers <= 0 {
+		pgresp.err = fmt.Errorf("Invalid workers %d", r.workers)
+		return pgresp
+	}
+
+	// 获取对象信息
+	getInfoResp := NewGetObjInfoRequest(r.bucket, r.objName).Do(p)
+	if err := getInfoResp.Err(); err != nil {
+		pgresp.err = fmt.Errorf("Get object info err, %w", err)
+		return pgresp
+	}
+	info := getInfoResp.(*GetObjInfoResponse)
+	if !info.IsExisted {
+		pgresp.err = fmt.Errorf("Get object info err, %w", errNoSuchKey())
+		return pgresp
+	}
+	r.objSize = info.Size
+
+	savePath, _ := filepath.Abs(r.savePath)
+	tmpPath := savePath + DownloadTempSuffix
+
+	saveErr := func() error {
+		f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("Open file %s err, %v", tmpPath, err)
+		}
+		defer f.Close()
+
+		// 预分配文件
+		if err = f.Truncate(r.objSize); err != nil {
+			return fmt.Errorf("Truncate file %s err, %v", tmpPath, err)
+		}
+
+		if err = r.getChunks(p, f, quoteETag(info.ETag)); err != nil {
+			return err
+		}
+
+		if err = f.Sync(); err != nil {
+			return fmt.Errorf("Sync object to file err, %v", err)
+		}
+		if err = os.Rename(tmpPath, savePath); err != nil {
+			return fmt.Errorf("Rename file err, %v", err)
+		}
+		return nil
+	}()
+
+	if saveErr != nil {
+		os.Remove(tmpPath)
+		pgresp.err = saveErr
+		return pgresp
+	}
+
+	r.setProgress(float64(100))
+	pgresp.Size = r.objSize
+	pgresp.ETag = info.ETag
+	return pgresp
+}
+
+func (r *ParallelGetObjRequest) setProgress(v float64) {
+	if !r.enableProgress {
+		return
+	}
+	r.progress.Store(v)
+}
+
+// getChunks: 并发下载所有分片并写入f
+func (r *ParallelGetObjRequest) getChunks(p *RequestParam, f *os.File, etag string) error {
+	if r.objSize <= 0 {
+		return nil
+	}
+
+	var (
+		chunksCount = int((r.objSize + r.chunkSize - 1) / r.chunkSize)
+		jobC        = make(chan int, chunksCount)
+		stopped     = int32(0)
+		downloaded  = int64(0)
+		errOnce     sync.Once
+		firstErr    error
+		wg          sync.WaitGroup
+	)
+
+	for i := 0; i < chunksCount; i++ {
+		jobC <- i
+	}
+	close(jobC)
+
+	for w := 0; w < r.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobC {
+				if atomic.LoadInt32(&stopped) > int32(0) {
+					return
+				}
+
+				start := int64(idx) * r.chunkSize
+				end := start + r.chunkSize - 1
+				if end >= r.objSize {
+					end = r.objSize - 1
+				}
+
+				if err := r.getChunk(p, f, etag, start, end); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("Get range %d-%d err, %w", start, end, err)
+					})
+					atomic.StoreInt32(&stopped, int32(1))
+					return
+				}
+
+				// 记录进度
+				done := atomic.AddInt64(&downloaded, end-start+1)
+				r.setProgress(float64(done * int64(100) / r.objSize))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// getChunk: 下载[start, end]并写入f的对应位置, 失败时最多重试r.retries次, 见retryPart
+func (r *ParallelGetObjRequest) getChunk(p *RequestParam, f *os.File, etag string, start, end int64) error {
+	return p.retryPart(r.retries, func() error {
+		req := NewGetObjStreamRequest(r.bucket, r.objName).SetRange(start, end)
+		if len(etag) > 0 {
+			req.SetIfRange(etag)
+		}
+		resp := req.Do(p)
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		gosresp := resp.(*GetObjStreamResponse)
+		defer gosresp.Body.Close()
+
+		// If-Range不满足时返回的是整个对象, 说明对象已经被修改, 不再重试
+		if !gosresp.Partial {
+			return errObjectModified()
+		}
+
+		written, err := io.Copy(&offsetWriter{f: f, offset: start}, gosresp.Body)
+		if err != nil {
+			return fmt.Errorf("Write file content err, %w", err)
+		}
+		if written != end-start+1 {
+			return fmt.Errorf("Loss of data during writing, %d bytes written, %d is needed", written, end-start+1)
+		}
+		return nil
+	})
+}
+
+type ParallelGetObjResponse struct {
+	Size int64
+	ETag string
+
+	err error
+}
+
+func (r ParallelGetObjResponse) Err() error {
+	return r.err
+}
+
+// offsetWriter: 从offset开始顺序调用WriteAt, 供多个分片并发写同一个文件
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(b []byte) (int, error) {
+	n, err := w.f.WriteAt(b, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,162 @@
+package ceph
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 常见的S3错误码
+const (
+	ErrCodeNoSuchKey             = "NoSuchKey"
+	ErrCodeNoSuchBucket          = "NoSuchBucket"
+	ErrCodeNoSuchUpload          = "NoSuchUpload"
+	ErrCodeAccessDenied          = "AccessDenied"
+	ErrCodeBucketNotEmpty        = "BucketNotEmpty"
+	ErrCodeBucketAlreadyExists   = "BucketAlreadyExists"
+	ErrCodeInvalidRange          = "InvalidRange"
+	ErrCodePreconditionFailed    = "PreconditionFailed"
+	ErrCodeRequestTimeTooSkewed  = "RequestTimeTooSkewed"
+	ErrCodeSignatureDoesNotMatch = "SignatureDoesNotMatch"
+	ErrCodeSlowDown              = "SlowDown"
+
+	// HEAD等没有body的响应, 只能根据状态码得到错误码
+	ErrCodeNotFound    = "NotFound"
+	ErrCodeNotModified = "NotModified"
+)
+
+// S3Error: 服务端返回的<Error>, 没有body时根据状态码生成
+type S3Error struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string   `xml:"Code"`
+	Message    string   `xml:"Message"`
+	Resource   string   `xml:"Resource"`
+	RequestId  string   `xml:"RequestId"`
+	HostId     string   `xml:"HostId"`
+	StatusCode int      `xml:"-"`
+}
+
+func (e *S3Error) Error() string {
+	msg := fmt.Sprintf("%s (status %d", e.Code, e.StatusCode)
+	if len(e.RequestId) > 0 {
+		msg += ", request id " + e.RequestId
+	}
+	msg += ")"
+	if len(e.Message) > 0 {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is: 使errors.Is(err, ErrBucketNotExist)对NoSuchBucket成立
+func (e *S3Error) Is(target error) bool {
+	return target == ErrBucketNotExist && e.Code == ErrCodeNoSuchBucket
+}
+
+// newS3Error: 解析失败响应的body, body为空或者不是<Error>时根据状态码填充Code
+func newS3Error(resp *http.Response, body []byte) error {
+	e := &S3Error{}
+	if len(body) > 0 {
+		if err := xml.Unmarshal(body, e); err != nil {
+			e.Message = string(body)
+		}
+	}
+
+	e.StatusCode = resp.StatusCode
+	if len(e.RequestId) <= 0 {
+		e.RequestId = resp.Header.Get("X-Amz-Request-Id")
+	}
+	if len(e.HostId) <= 0 {
+		e.HostId = resp.Header.Get("X-Amz-Id-2")
+	}
+	if len(e.Code) <= 0 {
+		e.Code = errCodeOfStatus(resp.StatusCode)
+	}
+	return e
+}
+
+// newHeadObjectError: HEAD对象的响应没有body, 404时按NoSuchKey处理
+func newHeadObjectError(resp *http.Response) error {
+	err := newS3Error(resp, nil)
+	if e := err.(*S3Error); e.Code == ErrCodeNotFound {
+		e.Code = ErrCodeNoSuchKey
+	}
+	return err
+}
+
+// errNoSuchKey: GetObjInfoRequest返回对象不存在时, 要求对象存在的请求使用的错误
+func errNoSuchKey() error {
+	return &S3Error{
+		Code:       ErrCodeNoSuchKey,
+		Message:    "The specified key does not exist.",
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+// errObjectModified: 下载过程中对象发生了变化, 按PreconditionFailed处理
+func errObjectModified() error {
+	return &S3Error{
+		Code:       ErrCodePreconditionFailed,
+		Message:    "Object has been modified during download",
+		StatusCode: http.StatusPreconditionFailed,
+	}
+}
+
+// errInvalidRange: 根据对象大小判断Range不满足时使用的错误, 和服务端返回416一致
+func errInvalidRange(rng string, size int64) error {
+	return &S3Error{
+		Code:       ErrCodeInvalidRange,
+		Message:    fmt.Sprintf("Range %s is not satisfiable for object size %d", rng, size),
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+	}
+}
+
+func errCodeOfStatus(status int) string {
+	switch status {
+	case http.StatusNotModified:
+		return ErrCodeNotModified
+	case http.StatusForbidden:
+		return ErrCodeAccessDenied
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusPreconditionFailed:
+		return ErrCodePreconditionFailed
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrCodeInvalidRange
+	case http.StatusServiceUnavailable:
+		return ErrCodeSlowDown
+	}
+	return http.StatusText(status)
+}
+
+// ErrorCode: 返回err中S3Error的错误码, 不是S3Error时返回空
+func ErrorCode(err error) string {
+	var e *S3Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+func IsNoSuchKey(err error) bool {
+	return ErrorCode(err) == ErrCodeNoSuchKey
+}
+
+func IsNoSuchBucket(err error) bool {
+	return ErrorCode(err) == ErrCodeNoSuchBucket
+}
+
+func IsAccessDenied(err error) bool {
+	return ErrorCode(err) == ErrCodeAccessDenied
+}
+
+// IsNotModified: 条件请求的If-None-Match | If-Modified-Since不满足(304)
+func IsNotModified(err error) bool {
+	return ErrorCode(err) == ErrCodeNotModified
+}
+
+// IsPreconditionFailed: 条件请求的If-Match | If-Unmodified-Since不满足(412)
+func IsPreconditionFailed(err error) bool {
+	return ErrorCode(err) == ErrCodePreconditionFailed
+}
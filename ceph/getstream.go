@@ -0,0 +1,294 @@
+package ceph
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////
+// GetObjStreamRequest: 获取对象内容的io.ReadCloser, 不落盘
+// 使用完后必需关闭GetObjStreamResponse.Body
+type GetObjStreamRequest struct {
+	bucket  string // [required]
+	objName string // [required]
+
+	// [optional] 只获取部分内容
+	rng *Range
+	// [optional] ETag或者http.TimeFormat格式的时间, 对象未变化时才按rng返回部分内容，否则返回全部内容
+	ifRange string
+}
+
+func NewGetObjStreamRequest(bucket, objName string) *GetObjStreamRequest {
+	return &GetObjStreamRequest{
+		bucket:  bucket,
+		objName: objName,
+	}
+}
+
+// SetRange: 获取[start, end]字节, end<0表示到对象末尾
+func (r *GetObjStreamRequest) SetRange(start, end int64) *GetObjStreamRequest {
+	r.rng = &Range{Start: start, End: end}
+	return r
+}
+
+// SetSuffixRange: 获取最后n个字节
+func (r *GetObjStreamRequest) SetSuffixRange(n int64) *GetObjStreamRequest {
+	r.rng = &Range{Suffix: n}
+	return r
+}
+
+func (r *GetObjStreamRequest) SetIfRange(v string) *GetObjStreamRequest {
+	r.ifRange = v
+	return r
+}
+
+func (r *GetObjStreamRequest) Do(p *RequestParam) Response {
+	var gosresp = &GetObjStreamResponse{}
+
+	// 参数校验
+	if p == nil {
+		gosresp.err = errors.New("Nil RequestParam")
+		return gosresp
+	}
+	if err := p.Validate(); err != nil {
+		gosresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return gosresp
+	}
+
+	// 发送获取对象请求
+	url := p.objectURL(r.bucket, r.objName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
+	if err != nil {
+		gosresp.err = fmt.Errorf("New http request err, %v", err)
+		return gosresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	if r.rng != nil {
+		v, err := r.rng.HeaderValue()
+		if err != nil {
+			gosresp.err = err
+			return gosresp
+		}
+		req.Header.Set("Range", v)
+		if len(r.ifRange) > 0 {
+			req.Header.Set("If-Range", r.ifRange)
+		}
+	}
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		gosresp.err = fmt.Errorf("Do request err, %w", err)
+		return gosresp
+	}
+
+	if resp.StatusCode != 200 && resp.StatusCode != 206 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		gosresp.err = newS3Error(resp, body)
+		return gosresp
+	}
+
+	// If-Range不满足时服务端返回200和全部内容
+	gosresp.Partial = (resp.StatusCode == 206)
+	gosresp.TotalSize = resp.ContentLength
+	if gosresp.Partial {
+		gosresp.TotalSize = parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	}
+
+	// body由调用者关闭
+	gosresp.Body = resp.Body
+	gosresp.Header = resp.Header
+	gosresp.Size = resp.ContentLength
+	gosresp.ContentType = resp.Header.Get("Content-Type")
+	gosresp.ETag = strings.Trim(resp.Header.Get("ETag"), "\"")
+	gosresp.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	gosresp.Metadata = UserMetadata(resp.Header)
+	return gosresp
+}
+
+type GetObjStreamResponse struct {
+	Body         io.ReadCloser
+	Size         int64 // 本次返回的字节数
+	TotalSize    int64 // 对象的总大小, 未知时为-1
+	Partial      bool  // 是否只返回了部分内容(206)
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string // x-amz-meta-*, key为去掉前缀后的小写形式
+	Header       http.Header
+
+	err error
+}
+
+func (r GetObjStreamResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+// GetObjToWriterRequest: 把对象内容写入任意io.Writer, 比如http.ResponseWriter、hash.Hash
+type GetObjToWriterRequest struct {
+	stream *GetObjStreamRequest // [required]
+	w      io.Writer            // [required]
+}
+
+func NewGetObjToWriterRequest(bucket, objName string, w io.Writer) *GetObjToWriterRequest {
+	return &GetObjToWriterRequest{
+		stream: NewGetObjStreamRequest(bucket, objName),
+		w:      w,
+	}
+}
+
+// SetRange: 获取[start, end]字节, end<0表示到对象末尾
+func (r *GetObjToWriterRequest) SetRange(start, end int64) *GetObjToWriterRequest {
+	r.stream.SetRange(start, end)
+	return r
+}
+
+// SetSuffixRange: 获取最后n个字节
+func (r *GetObjToWriterRequest) SetSuffixRange(n int64) *GetObjToWriterRequest {
+	r.stream.SetSuffixRange(n)
+	return r
+}
+
+func (r *GetObjToWriterRequest) SetIfRange(v string) *GetObjToWriterRequest {
+	r.stream.SetIfRange(v)
+	return r
+}
+
+func (r *GetObjToWriterRequest) Do(p *RequestParam) Response {
+	var gowresp = &GetObjToWriterResponse{}
+
+	if r.w == nil {
+		gowresp.err = errors.New("Nil writer")
+		return gowresp
+	}
+
+	resp := r.stream.Do(p)
+	if err := resp.Err(); err != nil {
+		gowresp.err = err
+		return gowresp
+	}
+	gosresp := resp.(*GetObjStreamResponse)
+	defer gosresp.Body.Close()
+
+	written, err := io.Copy(r.w, gosresp.Body)
+	gowresp.Written = written
+	if err != nil {
+		gowresp.err = fmt.Errorf("Copy object content err, %w", err)
+		return gowresp
+	}
+	if gosresp.Size >= 0 && written != gosresp.Size {
+		gowresp.err = fmt.Errorf("Loss of data during writing, %d bytes written, %d is needed", written, gosresp.Size)
+		return gowresp
+	}
+
+	gowresp.Partial = gosresp.Partial
+	gowresp.TotalSize = gosresp.TotalSize
+	gowresp.ContentType = gosresp.ContentType
+	gowresp.ETag = gosresp.ETag
+	gowresp.LastModified = gosresp.LastModified
+	gowresp.Metadata = gosresp.Metadata
+	return gowresp
+}
+
+type GetObjToWriterResponse struct {
+	Written      int64
+	TotalSize    int64
+	Partial      bool
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+
+	err error
+}
+
+func (r GetObjToWriterResponse) Err() error {
+	return r.err
+}
+
+// UserMetadata: 从响应头中提取x-amz-meta-*, 返回的key为去掉前缀后的小写形式
+func UserMetadata(h http.Header) map[string]string {
+	const prefix = "x-amz-meta-"
+
+	m := make(map[string]string)
+	for k, v := range h {
+		lowerKey := strings.ToLower(k)
+		if !strings.HasPrefix(lowerKey, prefix) || len(v) <= 0 {
+			continue
+		}
+		m[strings.TrimPrefix(lowerKey, prefix)] = strings.Join(v, ",")
+	}
+	return m
+}
+
+//////////////////////////////////////////////////////////////////
+// Range: HTTP Range请求头
+type Range struct {
+	Start int64
+	End   int64 // 包含End, <0表示到对象末尾
+
+	// >0时表示获取最后Suffix个字节, 此时忽略Start和End
+	Suffix int64
+}
+
+func (r Range) HeaderValue() (string, error) {
+	if r.Suffix > 0 {
+		return fmt.Sprintf("bytes=-%d", r.Suffix), nil
+	}
+	if r.Start < 0 {
+		return "", fmt.Errorf("Invalid range start %d", r.Start)
+	}
+	if r.End < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Start), nil
+	}
+	if r.End < r.Start {
+		return "", fmt.Errorf("Invalid range %d-%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End), nil
+}
+
+// resolve: 根据对象大小计算实际的[start, end], 超出对象范围时返回InvalidRange
+func (r Range) resolve(size int64) (int64, int64, error) {
+	v, err := r.HeaderValue()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start, end := r.Start, r.End
+	if r.Suffix > 0 {
+		start, end = size-r.Suffix, -1
+		if start < 0 {
+			start = 0
+		}
+	}
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	if start >= size {
+		return 0, 0, errInvalidRange(v, size)
+	}
+	return start, end, nil
+}
+
+// parseContentRangeTotal: 从"bytes 0-99/1234"中解析出总大小, 未知时返回-1
+func parseContentRangeTotal(v string) int64 {
+	idx := strings.LastIndex(v, "/")
+	if idx < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(v[idx+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
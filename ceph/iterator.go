@@ -0,0 +1,162 @@
+package ceph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ObjectIterator: 基于GetBucketRequest自动翻页列举bucket中的对象
+//
+//	it := NewObjectIterator(ctx, c, bucket, opt, 0)
+//	for it.Next() {
+//		if it.IsPrefix() {
+//			fmt.Println(it.Prefix())
+//			continue
+//		}
+//		fmt.Println(it.Object().Key)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ObjectIterator struct {
+	ctx    context.Context
+	c      *Ceph
+	bucket string
+	opt    GetBucketOption
+
+	// 最多返回的条目数(包括对象和CommonPrefixes)，<=0表示不限制
+	limit int
+	count int
+
+	// 当前页中尚未返回的条目
+	objs     []Object
+	prefixes []CommonPrefix
+
+	cur      Object
+	isPrefix bool
+
+	truncated bool
+	started   bool
+	err       error
+}
+
+// @param opt   : 可选, 设置Prefix、Delimiter、起始Marker以及每页的Maxkeys
+// @param limit : 最多返回的条目数，<=0表示不限制
+func NewObjectIterator(ctx context.Context, c *Ceph, bucket string, opt *GetBucketOption, limit int) *ObjectIterator {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opt == nil {
+		opt = DefaultGetBucketOption()
+	}
+	it := &ObjectIterator{
+		ctx:    ctx,
+		c:      c,
+		bucket: bucket,
+		opt:    *opt,
+		limit:  limit,
+	}
+	if it.opt.Maxkeys <= 0 {
+		it.opt.Maxkeys = DefaultGetBucketOption().Maxkeys
+	}
+	return it
+}
+
+// Next: 移动到下一个条目，没有更多条目或者出错时返回false
+func (it *ObjectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.limit > 0 && it.count >= it.limit {
+		return false
+	}
+
+	for len(it.objs) <= 0 && len(it.prefixes) <= 0 {
+		if it.started && !it.truncated {
+			return false
+		}
+		if err := it.fetch(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	// 对象和CommonPrefixes按照key的字典序合并返回
+	if len(it.prefixes) <= 0 || (len(it.objs) > 0 && it.objs[0].Key < it.prefixes[0].Prefix) {
+		it.cur = it.objs[0]
+		it.isPrefix = false
+		it.objs = it.objs[1:]
+	} else {
+		it.cur = Object{Key: it.prefixes[0].Prefix}
+		it.isPrefix = true
+		it.prefixes = it.prefixes[1:]
+	}
+	it.count++
+	return true
+}
+
+// Object: 当前的对象, 当IsPrefix()为true时只有Key有效
+func (it *ObjectIterator) Object() Object {
+	return it.cur
+}
+
+// IsPrefix: 当前条目是否为CommonPrefixes中的"目录"
+func (it *ObjectIterator) IsPrefix() bool {
+	return it.isPrefix
+}
+
+func (it *ObjectIterator) Prefix() string {
+	if !it.isPrefix {
+		return ""
+	}
+	return it.cur.Key
+}
+
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
+
+func (it *ObjectIterator) fetch() error {
+	select {
+	case <-it.ctx.Done():
+		return it.ctx.Err()
+	default:
+	}
+
+	if it.c == nil {
+		return errors.New("Nil Ceph")
+	}
+
+	opt := it.opt
+	if it.limit > 0 {
+		if remain := uint32(it.limit - it.count); remain < opt.Maxkeys {
+			opt.Maxkeys = remain
+		}
+	}
+
+	req := NewGetBucketRequest(it.bucket)
+	req.SetOption(&opt)
+	resp := it.c.DoContext(it.ctx, req)
+	if err := resp.Err(); err != nil {
+		return err
+	}
+
+	gbresp, ok := resp.(*GetBucketResponse)
+	if !ok {
+		return fmt.Errorf("Invalid response type %T", resp)
+	}
+
+	it.started = true
+	it.truncated = gbresp.IsTruncated
+	it.objs = gbresp.Contents
+	it.prefixes = gbresp.CommonPrefixes
+
+	if it.truncated {
+		if len(gbresp.NextMarker) <= 0 {
+			return errors.New("Truncated listing without next marker")
+		}
+		it.opt.Marker = gbresp.NextMarker
+	}
+	return nil
+}
@@ -0,0 +1,914 @@
+package ceph
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MinPartSize     = 5 * 1024 * 1024        // 除最后一个分块外, 每个分块最小5MB
+	MaxPartSize     = 5 * 1024 * 1024 * 1024 // 每个分块最大5GB
+	MaxPartsCount   = 10000                  // 最多10000个分块
+	DefaultPartSize = 16 * 1024 * 1024
+
+	DefaultUploadWorkers = 4
+	DefaultPartRetries   = 3
+)
+
+// Part: 已上传的分块
+type Part struct {
+	XMLName      xml.Name  `xml:"Part"`
+	PartNumber   int       `xml:"PartNumber"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"` // 已去除两边的引号
+	Size         int64     `xml:"Size"`
+}
+
+// CompletePart: 完成分块上传时提交的分块
+type CompletePart struct {
+	XMLName    xml.Name `xml:"Part" json:"-"`
+	PartNumber int      `xml:"PartNumber" json:"part_number"`
+	ETag       string   `xml:"ETag" json:"etag"`
+}
+
+//////////////////////////////////////////////////////////////////
+type InitMultipartUploadRequest struct {
+	bucket  string // [required]
+	objName string // [required]
+
+	// [optional] 默认binary/octet-stream
+	contentType string
+	// [optional] 对象的其他头, 比如Cache-Control、x-amz-meta-*
+	header http.Header
+}
+
+func NewInitMultipartUploadRequest(bucket, objName string) *InitMultipartUploadRequest {
+	return &InitMultipartUploadRequest{
+		bucket:      bucket,
+		objName:     objName,
+		contentType: "binary/octet-stream",
+		header:      make(http.Header),
+	}
+}
+
+func (r *InitMultipartUploadRequest) SetContentType(contentType string) *InitMultipartUploadRequest {
+	r.contentType = contentType
+	return r
+}
+
+func (r *InitMultipartUploadRequest) SetHeader(k, v string) *InitMultipartUploadRequest {
+	r.header.Set(k, v)
+	return r
+}
+
+func (r *InitMultipartUploadRequest) Do(p *RequestParam) Response {
+	var imuresp = &InitMultipartUploadResponse{}
+
+	// 参数校验
+	if p == nil {
+		imuresp.err = errors.New("Nil RequestParam")
+		return imuresp
+	}
+	if err := p.Validate(); err != nil {
+		imuresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return imuresp
+	}
+
+	// 发送请求
+	url := p.objectURL(r.bucket, r.objName, "uploads")
+	req, err := http.NewRequestWithContext(p.Context(), "POST", url, nil)
+	if err != nil {
+		imuresp.err = fmt.Errorf("New http request err, %v", err)
+		return imuresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Content-Type", r.contentType)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		imuresp.err = fmt.Errorf("Do request err, %w", err)
+		return imuresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		imuresp.err = fmt.Errorf("Read response body err, %v", err)
+		return imuresp
+	}
+
+	if resp.StatusCode != 200 {
+		imuresp.err = newS3Error(resp, respBody)
+		return imuresp
+	}
+
+	if err = xml.Unmarshal(respBody, imuresp); err != nil {
+		imuresp.err = fmt.Errorf("Unmarshal response body err, %v", err)
+		return imuresp
+	}
+	return imuresp
+}
+
+type InitMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+
+	err error
+}
+
+func (r InitMultipartUploadResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type UploadPartRequest struct {
+	bucket     string        // [required]
+	objName    string        // [required]
+	uploadId   string        // [required]
+	partNumber int           // [required] [1, 10000]
+	body       io.ReadSeeker // [required] 从当前位置读取size字节
+	size       int64         // [required]
+}
+
+func NewUploadPartRequest(bucket, objName, uploadId string, partNumber int, body io.ReadSeeker, size int64) *UploadPartRequest {
+	return &UploadPartRequest{
+		bucket:     bucket,
+		objName:    objName,
+		uploadId:   uploadId,
+		partNumber: partNumber,
+		body:       body,
+		size:       size,
+	}
+}
+
+func (r *UploadPartRequest) Do(p *RequestParam) Response {
+	var upresp = &UploadPartResponse{}
+
+	// 参数校验
+	if p == nil {
+		upresp.err = errors.New("Nil RequestParam")
+		return upresp
+	}
+	if err := p.Validate(); err != nil {
+		upresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return upresp
+	}
+	if r.partNumber < 1 || r.partNumber > MaxPartsCount {
+		upresp.err = fmt.Errorf("Invalid part number %d", r.partNumber)
+		return upresp
+	}
+	if r.body == nil {
+		upresp.err = errors.New("Nil part body")
+		return upresp
+	}
+
+	// 计算md5, 需要时同时计算sha256
+	start, err := r.body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		upresp.err = fmt.Errorf("Seek part body err, %v", err)
+		return upresp
+	}
+	var (
+		md5h = md5.New()
+		shah = sha256.New()
+		w    = io.Writer(md5h)
+	)
+	if p.SignVersion == SignV4 && p.PayloadMode == PayloadSigned {
+		w = io.MultiWriter(md5h, shah)
+	}
+	if _, err = io.CopyN(w, r.body, r.size); err != nil {
+		upresp.err = fmt.Errorf("Read part body err, %v", err)
+		return upresp
+	}
+	if _, err = r.body.Seek(start, io.SeekStart); err != nil {
+		upresp.err = fmt.Errorf("Seek part body err, %v", err)
+		return upresp
+	}
+	b64Md5 := base64.StdEncoding.EncodeToString(md5h.Sum(nil))
+
+	// 发送请求
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(r.partNumber))
+	query.Set("uploadId", r.uploadId)
+	url := p.objectURL(r.bucket, r.objName, query.Encode())
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, nil)
+	if err != nil {
+		upresp.err = fmt.Errorf("New http request err, %v", err)
+		return upresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Content-MD5", b64Md5)
+
+	var (
+		seed     string // 流式签名时的seed signature
+		bodySize = r.size
+	)
+	if p.SignVersion != SignV4 {
+		p.Sign(req, "")
+	} else {
+		switch p.PayloadMode {
+		case PayloadSigned:
+			p.Sign(req, hex.EncodeToString(shah.Sum(nil)))
+		case PayloadStreaming:
+			req.Header.Set("Content-Encoding", "aws-chunked")
+			req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(r.size, 10))
+			seed = p.Sign(req, StreamingPayload)
+			bodySize = StreamingContentLength(r.size)
+		default:
+			p.Sign(req, UnsignedPayload)
+		}
+	}
+
+	// 每次都从分块的开头读取, 重试时可以重新发送
+	readPart := sectionBody(r.body, start, r.size)
+	newBody := func() (io.Reader, error) {
+		body, err := readPart()
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) <= 0 {
+			return body, nil
+		}
+		sr, err := NewStreamingReader(body, p.SecretKey, p.Region, req.Header.Get("X-Amz-Date"), seed)
+		if err != nil {
+			return nil, fmt.Errorf("New streaming reader err, %v", err)
+		}
+		return sr, nil
+	}
+	if err = setBody(req, bodySize, newBody); err != nil {
+		upresp.err = err
+		return upresp
+	}
+
+	resp, err := p.do(req)
+	if err != nil {
+		upresp.err = fmt.Errorf("Do request err, %w", err)
+		return upresp
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		upresp.err = newS3Error(resp, respBody)
+		return upresp
+	}
+
+	upresp.PartNumber = r.partNumber
+	upresp.ETag = strings.Trim(resp.Header.Get("ETag"), "\"")
+	upresp.Base64Md5 = b64Md5
+	return upresp
+}
+
+type UploadPartResponse struct {
+	PartNumber int
+	ETag       string
+	Base64Md5  string
+
+	err error
+}
+
+func (r UploadPartResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type completeMultipartUploadBody struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []CompletePart `xml:"Part"`
+}
+
+type CompleteMultipartUploadRequest struct {
+	bucket   string         // [required]
+	objName  string         // [required]
+	uploadId string         // [required]
+	parts    []CompletePart // [required]
+}
+
+func NewCompleteMultipartUploadRequest(bucket, objName, uploadId string, parts []CompletePart) *CompleteMultipartUploadRequest {
+	return &CompleteMultipartUploadRequest{
+		bucket:   bucket,
+		objName:  objName,
+		uploadId: uploadId,
+		parts:    parts,
+	}
+}
+
+func (r *CompleteMultipartUploadRequest) Do(p *RequestParam) Response {
+	var cmuresp = &CompleteMultipartUploadResponse{}
+
+	// 参数校验
+	if p == nil {
+		cmuresp.err = errors.New("Nil RequestParam")
+		return cmuresp
+	}
+	if err := p.Validate(); err != nil {
+		cmuresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return cmuresp
+	}
+	if len(r.parts) <= 0 {
+		cmuresp.err = errors.New("Empty parts")
+		return cmuresp
+	}
+
+	// 分块必需按照PartNumber升序提交, ETag需要带引号
+	parts := make([]CompletePart, 0, len(r.parts))
+	for _, part := range r.parts {
+		part.ETag = quoteETag(part.ETag)
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	body, err := xml.Marshal(completeMultipartUploadBody{Parts: parts})
+	if err != nil {
+		cmuresp.err = fmt.Errorf("Marshal complete body err, %v", err)
+		return cmuresp
+	}
+
+	// 发送请求
+	query := url.Values{}
+	query.Set("uploadId", r.uploadId)
+	url := p.objectURL(r.bucket, r.objName, query.Encode())
+	req, err := http.NewRequestWithContext(p.Context(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		cmuresp.err = fmt.Errorf("New http request err, %v", err)
+		return cmuresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Content-Type", "application/xml")
+	p.Sign(req, HexSHA256(body))
+
+	resp, err := p.do(req)
+	if err != nil {
+		cmuresp.err = fmt.Errorf("Do request err, %w", err)
+		return cmuresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		cmuresp.err = fmt.Errorf("Read response body err, %v", err)
+		return cmuresp
+	}
+
+	// 合并过程中出错时也可能返回200, 此时body为Error
+	if resp.StatusCode != 200 || bytes.Contains(respBody, []byte("<Error>")) {
+		cmuresp.err = newS3Error(resp, respBody)
+		return cmuresp
+	}
+
+	if err = xml.Unmarshal(respBody, cmuresp); err != nil {
+		cmuresp.err = fmt.Errorf("Unmarshal response body err, %v", err)
+		return cmuresp
+	}
+	cmuresp.ETag = strings.Trim(cmuresp.ETag, "\"")
+	return cmuresp
+}
+
+type CompleteMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"` // 已去除两边的引号, 格式为"<md5>-<分块数>"
+
+	err error
+}
+
+func (r CompleteMultipartUploadResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type AbortMultipartUploadRequest struct {
+	bucket   string // [required]
+	objName  string // [required]
+	uploadId string // [required]
+}
+
+func NewAbortMultipartUploadRequest(bucket, objName, uploadId string) *AbortMultipartUploadRequest {
+	return &AbortMultipartUploadRequest{
+		bucket:   bucket,
+		objName:  objName,
+		uploadId: uploadId,
+	}
+}
+
+func (r *AbortMultipartUploadRequest) Do(p *RequestParam) Response {
+	var amuresp = &AbortMultipartUploadResponse{}
+
+	// 参数校验
+	if p == nil {
+		amuresp.err = errors.New("Nil RequestParam")
+		return amuresp
+	}
+	if err := p.Validate(); err != nil {
+		amuresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return amuresp
+	}
+
+	// 发送请求
+	query := url.Values{}
+	query.Set("uploadId", r.uploadId)
+	url := p.objectURL(r.bucket, r.objName, query.Encode())
+	req, err := http.NewRequestWithContext(p.Context(), "DELETE", url, nil)
+	if err != nil {
+		amuresp.err = fmt.Errorf("New http request err, %v", err)
+		return amuresp
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		amuresp.err = fmt.Errorf("Do request err, %w", err)
+		return amuresp
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		amuresp.err = newS3Error(resp, respBody)
+		return amuresp
+	}
+	return amuresp
+}
+
+type AbortMultipartUploadResponse struct {
+	err error
+}
+
+func (r AbortMultipartUploadResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type listPartsResult struct {
+	XMLName              xml.Name `xml:"ListPartsResult"`
+	IsTruncated          bool     `xml:"IsTruncated"`
+	NextPartNumberMarker int      `xml:"NextPartNumberMarker"`
+	Parts                []Part   `xml:"Part"`
+}
+
+// ListPartsRequest: 列举某次分块上传中已上传的分块, 自动翻页直到返回全部分块
+type ListPartsRequest struct {
+	bucket   string // [required]
+	objName  string // [required]
+	uploadId string // [required]
+}
+
+func NewListPartsRequest(bucket, objName, uploadId string) *ListPartsRequest {
+	return &ListPartsRequest{
+		bucket:   bucket,
+		objName:  objName,
+		uploadId: uploadId,
+	}
+}
+
+func (r *ListPartsRequest) Do(p *RequestParam) Response {
+	var lpresp = &ListPartsResponse{}
+
+	// 参数校验
+	if p == nil {
+		lpresp.err = errors.New("Nil RequestParam")
+		return lpresp
+	}
+	if err := p.Validate(); err != nil {
+		lpresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return lpresp
+	}
+
+	marker := 0
+	for {
+		result, err := r.listPage(p, marker)
+		if err != nil {
+			lpresp.err = err
+			return lpresp
+		}
+		lpresp.Parts = append(lpresp.Parts, result.Parts...)
+
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	return lpresp
+}
+
+func (r *ListPartsRequest) listPage(p *RequestParam, marker int) (*listPartsResult, error) {
+	query := url.Values{}
+	query.Set("uploadId", r.uploadId)
+	if marker > 0 {
+		query.Set("part-number-marker", strconv.Itoa(marker))
+	}
+	url := p.objectURL(r.bucket, r.objName, query.Encode())
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("New http request err, %v", err)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Do request err, %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Read response body err, %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, newS3Error(resp, respBody)
+	}
+
+	result := &listPartsResult{}
+	if err = xml.Unmarshal(respBody, result); err != nil {
+		return nil, fmt.Errorf("Unmarshal response body err, %v", err)
+	}
+	for i := range result.Parts {
+		result.Parts[i].ETag = strings.Trim(result.Parts[i].ETag, "\"")
+	}
+	return result, nil
+}
+
+type ListPartsResponse struct {
+	Parts []Part
+
+	err error
+}
+
+func (r ListPartsResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+// MultipartPutObjRequest: 把本地文件拆分为多个分块并发上传, 单个分块失败时会重试
+// 上传失败时会终止本次分块上传
+type MultipartPutObjRequest struct {
+	bucket   string // [required]
+	objName  string // [required]
+	filePath string // [required]
+
+	// [optional] 分块大小, 默认16MB; 分块数超过10000时会自动调大
+	partSize int64
+	// [optional] 并发上传的分块数, 默认4
+	workers int
+	// [optional] 单个分块失败后的重试次数, 默认3
+	retries int
+	// [optional] 默认binary/octet-stream
+	contentType string
+	// [optional] 对象的其他头, 比如Cache-Control、x-amz-meta-*
+	header http.Header
+	// [optional] 是否在源文件旁保存断点文件, 默认false
+	// 开启后上传失败不会终止分块上传，再次上传同一文件时从断点处继续
+	checkpoint bool
+
+	/* 以下内部使用 */
+	enableProgress bool
+	progress       atomic.Value // [0,100] float64
+	onProgress     func(float64)
+}
+
+func NewMultipartPutObjRequest(bucket, objName, filePath string) *MultipartPutObjRequest {
+	return &MultipartPutObjRequest{
+		bucket:      bucket,
+		objName:     objName,
+		filePath:    filePath,
+		partSize:    DefaultPartSize,
+		workers:     DefaultUploadWorkers,
+		retries:     DefaultPartRetries,
+		contentType: "binary/octet-stream",
+		header:      make(http.Header),
+	}
+}
+
+func (r *MultipartPutObjRequest) SetPartSize(size int64) *MultipartPutObjRequest {
+	r.partSize = size
+	return r
+}
+
+func (r *MultipartPutObjRequest) SetWorkers(n int) *MultipartPutObjRequest {
+	r.workers = n
+	return r
+}
+
+func (r *MultipartPutObjRequest) SetRetries(n int) *MultipartPutObjRequest {
+	r.retries = n
+	return r
+}
+
+func (r *MultipartPutObjRequest) SetContentType(contentType string) *MultipartPutObjRequest {
+	r.contentType = contentType
+	return r
+}
+
+// SetHeader: 设置对象的其他头, 在初始化分块上传时发送
+func (r *MultipartPutObjRequest) SetHeader(k, v string) *MultipartPutObjRequest {
+	r.header.Set(k, v)
+	return r
+}
+
+func (r *MultipartPutObjRequest) SetCheckpoint(enable bool) *MultipartPutObjRequest {
+	r.checkpoint = enable
+	return r
+}
+
+func (r *MultipartPutObjRequest) SetEnableProgress(enable bool) *MultipartPutObjRequest {
+	r.enableProgress = enable
+	r.progress.Store(float64(0))
+	return r
+}
+
+func (r *MultipartPutObjRequest) Progress() float64 {
+	v := r.progress.Load()
+	return v.(float64)
+}
+
+func (r *MultipartPutObjRequest) setProgress(v float64) {
+	if !r.enableProgress {
+		return
+	}
+	r.progress.Store(v)
+	if r.onProgress != nil {
+		r.onProgress(v)
+	}
+}
+
+func (r *MultipartPutObjRequest) Do(p *RequestParam) Response {
+	var mpresp = &MultipartPutObjResponse{}
+
+	// 参数校验
+	if p == nil {
+		mpresp.err = errors.New("Nil RequestParam")
+		return mpresp
+	}
+	if err := p.Validate(); err != nil {
+		mpresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return mpresp
+	}
+	if r.partSize < MinPartSize || r.partSize > MaxPartSize {
+		mpresp.err = fmt.Errorf("Invalid part size %d", r.partSize)
+		return mpresp
+	}
+	if r.workers <= 0 {
+		r.workers = DefaultUploadWorkers
+	}
+
+	f, err := os.Open(r.filePath)
+	if err != nil {
+		mpresp.err = fmt.Errorf("Open %s err, %v", r.filePath, err)
+		return mpresp
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		mpresp.err = fmt.Errorf("Stat %s err, %v", r.filePath, err)
+		return mpresp
+	}
+	fileSize := stat.Size()
+	partSize, err := OptimalPartSize(fileSize, r.partSize)
+	if err != nil {
+		mpresp.err = err
+		return mpresp
+	}
+
+	// 优先从断点继续上传
+	var (
+		uploadId string
+		cp       *uploadCheckpoint
+	)
+	if r.checkpoint {
+		if cp, err = loadUploadCheckpoint(p, r.bucket, r.objName, r.filePath, stat); err != nil {
+			mpresp.err = fmt.Errorf("Load checkpoint err, %w", err)
+			return mpresp
+		}
+	}
+	if cp != nil {
+		uploadId = cp.UploadId
+		partSize = cp.PartSize
+	} else {
+		// 初始化分块上传
+		initReq := NewInitMultipartUploadRequest(r.bucket, r.objName).SetContentType(r.contentType)
+		for k := range r.header {
+			initReq.SetHeader(k, r.header.Get(k))
+		}
+		initResp := initReq.Do(p)
+		if err := initResp.Err(); err != nil {
+			mpresp.err = fmt.Errorf("Init multipart upload err, %w", err)
+			return mpresp
+		}
+		uploadId = initResp.(*InitMultipartUploadResponse).UploadId
+
+		if r.checkpoint {
+			cp = newUploadCheckpoint(r.bucket, r.objName, r.filePath, uploadId, partSize, stat)
+			if err := cp.save(); err != nil {
+				NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+				mpresp.err = err
+				return mpresp
+			}
+		}
+	}
+
+	// 开启断点续传时失败后保留已上传的分块
+	abort := func() {
+		if cp == nil {
+			NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+		}
+	}
+
+	parts, err := r.uploadParts(p, f, uploadId, fileSize, partSize, cp)
+	if err != nil {
+		abort()
+		mpresp.err = err
+		return mpresp
+	}
+
+	// 合并分块
+	completeResp := NewCompleteMultipartUploadRequest(r.bucket, r.objName, uploadId, parts).Do(p)
+	if err := completeResp.Err(); err != nil {
+		abort()
+		mpresp.err = fmt.Errorf("Complete multipart upload err, %w", err)
+		return mpresp
+	}
+	if cp != nil {
+		cp.remove()
+	}
+
+	r.setProgress(float64(100))
+	mpresp.UploadId = uploadId
+	mpresp.ETag = completeResp.(*CompleteMultipartUploadResponse).ETag
+	mpresp.Location = completeResp.(*CompleteMultipartUploadResponse).Location
+	return mpresp
+}
+
+// uploadParts: 使用r.workers个协程并发上传所有分块
+// @param cp: 可选, 跳过断点中已上传的分块，并在每个分块上传成功后更新断点
+func (r *MultipartPutObjRequest) uploadParts(p *RequestParam, f *os.File, uploadId string, fileSize, partSize int64, cp *uploadCheckpoint) ([]CompletePart, error) {
+	partsCount := int((fileSize + partSize - 1) / partSize)
+	if partsCount <= 0 {
+		// 空文件也需要上传一个分块
+		partsCount = 1
+	}
+
+	var (
+		parts    = make([]CompletePart, partsCount)
+		jobC     = make(chan int, partsCount)
+		stopped  = int32(0)
+		uploaded = int64(0)
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	partSizeOf := func(partNumber int) int64 {
+		offset := int64(partNumber-1) * partSize
+		if offset+partSize > fileSize {
+			return fileSize - offset
+		}
+		return partSize
+	}
+
+	if cp != nil {
+		for _, part := range cp.Parts {
+			if part.PartNumber < 1 || part.PartNumber > partsCount {
+				continue
+			}
+			parts[part.PartNumber-1] = part
+			uploaded += partSizeOf(part.PartNumber)
+		}
+	}
+
+	for i := 1; i <= partsCount; i++ {
+		if len(parts[i-1].ETag) > 0 {
+			continue
+		}
+		jobC <- i
+	}
+	close(jobC)
+
+	for w := 0; w < r.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for partNumber := range jobC {
+				if atomic.LoadInt32(&stopped) > int32(0) {
+					return
+				}
+
+				offset := int64(partNumber-1) * partSize
+				size := partSizeOf(partNumber)
+
+				etag, err := r.uploadPart(p, f, uploadId, partNumber, offset, size)
+				if err == nil && cp != nil {
+					err = cp.addPart(CompletePart{PartNumber: partNumber, ETag: etag})
+				}
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("Upload part %d err, %w", partNumber, err)
+					})
+					atomic.StoreInt32(&stopped, int32(1))
+					return
+				}
+				parts[partNumber-1] = CompletePart{PartNumber: partNumber, ETag: etag}
+
+				// 记录进度
+				done := atomic.AddInt64(&uploaded, size)
+				if fileSize > 0 {
+					r.setProgress(float64(done * int64(100) / fileSize))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return parts, nil
+}
+
+// uploadPart: 上传单个分块, 失败时最多重试r.retries次, 见retryPart
+func (r *MultipartPutObjRequest) uploadPart(p *RequestParam, f *os.File, uploadId string, partNumber int, offset, size int64) (string, error) {
+	var etag string
+	err := p.retryPart(r.retries, func() error {
+		body := io.NewSectionReader(f, offset, size)
+		resp := NewUploadPartRequest(r.bucket, r.objName, uploadId, partNumber, body, size).Do(p)
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		etag = resp.(*UploadPartResponse).ETag
+		return nil
+	})
+	return etag, err
+}
+
+type MultipartPutObjResponse struct {
+	UploadId string
+	ETag     string
+	Location string
+
+	err error
+}
+
+func (r MultipartPutObjResponse) Err() error {
+	return r.err
+}
+
+// OptimalPartSize: 保证分块数不超过MaxPartsCount, 必要时按MB向上调大分块
+// 分块需要超过MaxPartSize时(文件大于MaxPartSize*MaxPartsCount)返回错误
+func OptimalPartSize(fileSize, partSize int64) (int64, error) {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if fileSize <= partSize*MaxPartsCount {
+		return partSize, nil
+	}
+
+	const mb = 1024 * 1024
+	partSize = (fileSize + MaxPartsCount - 1) / MaxPartsCount
+	partSize = (partSize + mb - 1) / mb * mb
+	if partSize > MaxPartSize {
+		return 0, fmt.Errorf("File size %d exceeds the max object size %d of multipart upload", fileSize, int64(MaxPartSize)*MaxPartsCount)
+	}
+	return partSize, nil
+}
@@ -1,20 +1,20 @@
 package ceph
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -24,6 +24,11 @@ const (
 	TypeByName = 2
 )
 
+const (
+	DownloadTempSuffix = ".download"
+	DownloadETagSuffix = ".etag"
+)
+
 type PutObjRequest struct {
 	bucket   string // [required]
 	objName  string // [required]
@@ -35,6 +40,20 @@ type PutObjRequest struct {
 	signed  bool
 	expired int64
 
+	// 是否使用分块上传, 默认不使用
+	multipart bool
+	partSize  int64
+	workers   int
+	// 是否开启断点续传, 开启后自动使用分块上传
+	resumable bool
+
+	// 为空时根据对象名或者文件名的扩展名检测, 无法检测时为binary/octet-stream
+	contentType string
+	// Content-Disposition、Cache-Control、x-amz-meta-*等对象头
+	header http.Header
+	// [optional] canned ACL或者x-amz-grant-*
+	acl aclOption
+
 	/* 以下内部使用 */
 	enableProgress bool
 	progress       atomic.Value // [0,100] float64
@@ -45,6 +64,7 @@ func NewPutObjRequest(bucket, objName, filePath string) *PutObjRequest {
 		bucket:   bucket,
 		objName:  objName,
 		filePath: filePath,
+		header:   make(http.Header),
 	}
 }
 
@@ -64,6 +84,77 @@ func (r *PutObjRequest) DisableGenDownloadUrl() *PutObjRequest {
 	return r
 }
 
+// EnableMultipart: 使用分块并发上传，适用于大文件
+// @param partSize : 分块大小，<=0时使用DefaultPartSize
+// @param workers  : 并发上传的分块数，<=0时使用DefaultUploadWorkers
+func (r *PutObjRequest) EnableMultipart(partSize int64, workers int) *PutObjRequest {
+	r.multipart = true
+	r.partSize = partSize
+	r.workers = workers
+	return r
+}
+
+// SetResumable: 开启断点续传, 在源文件旁保存断点文件(filePath + UploadCheckpointSuffix)
+// 进程崩溃后对同一bucket/object/file再次执行PutObjRequest时会从断点处继续上传
+// 源文件发生变化时会丢弃断点重新上传
+func (r *PutObjRequest) SetResumable(enable bool) *PutObjRequest {
+	r.resumable = enable
+	return r
+}
+
+func (r *PutObjRequest) SetContentType(contentType string) *PutObjRequest {
+	r.contentType = contentType
+	return r
+}
+
+// SetContentDisposition: 比如`attachment; filename="a.txt"`
+func (r *PutObjRequest) SetContentDisposition(v string) *PutObjRequest {
+	r.header.Set("Content-Disposition", v)
+	return r
+}
+
+// SetContentEncoding: 比如gzip, 下载时原样返回
+func (r *PutObjRequest) SetContentEncoding(v string) *PutObjRequest {
+	r.header.Set("Content-Encoding", v)
+	return r
+}
+
+func (r *PutObjRequest) SetCacheControl(v string) *PutObjRequest {
+	r.header.Set("Cache-Control", v)
+	return r
+}
+
+func (r *PutObjRequest) SetExpires(t time.Time) *PutObjRequest {
+	r.header.Set("Expires", t.UTC().Format(http.TimeFormat))
+	return r
+}
+
+// SetMetadata: 设置x-amz-meta-*
+// @param k: 不带x-amz-meta-前缀
+func (r *PutObjRequest) SetMetadata(k, v string) *PutObjRequest {
+	r.header.Set("X-Amz-Meta-"+k, v)
+	return r
+}
+
+// SetACL: 设置canned ACL, 比如ACLPublicRead
+func (r *PutObjRequest) SetACL(acl string) *PutObjRequest {
+	r.acl.setCanned(acl)
+	return r
+}
+
+// SetGrant: 通过x-amz-grant-*头授予grantees权限, 不能和SetACL同时使用
+func (r *PutObjRequest) SetGrant(permission string, grantees ...Grantee) *PutObjRequest {
+	r.acl.addGrant(permission, grantees)
+	return r
+}
+
+func (r *PutObjRequest) getContentType() string {
+	if len(r.contentType) > 0 {
+		return r.contentType
+	}
+	return DetectContentType(r.objName, r.filePath)
+}
+
 func (r *PutObjRequest) SetEnableProgress(enable bool) *PutObjRequest {
 	r.enableProgress = enable
 	r.progress.Store(float64(0))
@@ -87,6 +178,14 @@ func (r *PutObjRequest) Do(p *RequestParam) Response {
 		poresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
 		return poresp
 	}
+	if err := r.acl.validate(); err != nil {
+		poresp.err = err
+		return poresp
+	}
+
+	if r.multipart || r.resumable {
+		return r.doMultipart(p)
+	}
 
 	// 计算文件大小和base64(md5)
 	f, err := os.Open(r.filePath)
@@ -106,207 +205,161 @@ func (r *PutObjRequest) Do(p *RequestParam) Response {
 	}
 
 	// 发送请求
-	// 新建一个http.Request是为了生成签名用
-	url := fmt.Sprintf("http://%s/%s/%s", p.Host, r.bucket, r.objName)
-	req, err := http.NewRequest("PUT", url, nil)
+	url := p.objectURL(r.bucket, r.objName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, nil)
 	if err != nil {
 		poresp.err = fmt.Errorf("New http request err, %v", err)
 		return poresp
 	}
-	req.Header.Set("Date", GMTime())
-	req.Header.Set("Content-Type", "binary/octet-stream")
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Content-Type", r.getContentType())
 	req.Header.Set("Content-MD5", md5)
-	sign := Signature(p.SecretKey, req)
-
-	buf := bytes.NewBuffer(nil)
-	buf.WriteString(fmt.Sprintf("PUT /%s/%s HTTP/1.1\r\n", r.bucket, r.objName))
-	buf.WriteString(fmt.Sprintf("Host: %s\r\n", p.Host))
-	buf.WriteString("User-Agent: Go-http-client/1.1\r\n")
-	buf.WriteString("Accept-Encoding: identity\r\n")
-	buf.WriteString(fmt.Sprintf("Content-Type: %s\r\n", req.Header.Get("Content-Type")))
-	buf.WriteString(fmt.Sprintf("Content-Length: %d\r\n", fileSize))
-	buf.WriteString(fmt.Sprintf("Content-MD5: %s\r\n", req.Header.Get("Content-MD5")))
-	buf.WriteString(fmt.Sprintf("Date: %s\r\n", req.Header.Get("Date")))
-	buf.WriteString(fmt.Sprintf("Authorization: AWS %s:%s\r\n", p.AccessKey, sign))
-	buf.WriteString("\r\n")
-
-	// 新建到ceph的tcp连接
-	conn, err := net.DialTimeout("tcp", p.Host, 5*time.Second)
-	if err != nil {
-		poresp.err = fmt.Errorf("Dial %s err, %v", p.Host, err)
-		return poresp
+	for k, v := range r.header {
+		req.Header[k] = v
 	}
-	defer conn.Close()
+	r.acl.setHeader(req.Header)
 
+	// 需要发送的body长度
 	var (
-		notifyErrC = make(chan error, 2)
-		respBufC   = make(chan *http.Response, 1)
-		writeDoneC = make(chan struct{})
-		stopped    = int32(0)
-		wg         sync.WaitGroup
+		seed     string // 流式签名时的seed signature
+		bodySize = fileSize
 	)
 
-	defer func() {
-		close(notifyErrC)
-		close(respBufC)
-		close(writeDoneC)
-	}()
-
-	// 读取返回, 因为对方发送完回复后会立刻关闭连接，所以必需在对方发送的时候保证有读操作
-	go func(w *sync.WaitGroup) {
-		w.Add(1)
-		defer func() {
-			recover()
-			w.Done()
-		}()
-
-		respReader := bufio.NewReader(conn)
-		for {
-			if atomic.LoadInt32(&stopped) > int32(0) {
-				break
-			}
-			conn.SetReadDeadline(time.Now().Add(time.Second))
-			resp, err := http.ReadResponse(respReader, nil)
+	if p.SignVersion != SignV4 {
+		p.Sign(req, "")
+	} else {
+		switch p.PayloadMode {
+		case PayloadSigned:
+			sha, err := HexSHA256File(f)
 			if err != nil {
-				opErr, ok := err.(*net.OpError)
-				if !ok || opErr.Timeout() == false {
-					notifyErrC <- err
-					return
-				}
-			} else {
-				respBufC <- resp
+				poresp.err = fmt.Errorf("Cal %s sha256 err, %v", r.filePath, err)
+				return poresp
+			}
+			p.Sign(req, sha)
+		case PayloadStreaming:
+			// aws-chunked必需在最前面, 服务端去掉后保存剩下的Content-Encoding
+			contentEncoding := "aws-chunked"
+			if v := r.header.Get("Content-Encoding"); len(v) > 0 {
+				contentEncoding += "," + v
 			}
-			time.Sleep(100 * time.Millisecond)
+			req.Header.Set("Content-Encoding", contentEncoding)
+			req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(fileSize, 10))
+			seed = p.Sign(req, StreamingPayload)
+			bodySize = StreamingContentLength(fileSize)
+		default:
+			p.Sign(req, UnsignedPayload)
 		}
-	}(&wg)
-
-	// 发送请求
-	go func(w *sync.WaitGroup) {
-		w.Add(1)
-		defer func() {
-			recover()
-			w.Done()
-		}()
+	}
 
-		var (
-			err            error
-			n              int
-			writeCount     int64
-			lastUpdateTime time.Time
-		)
-
-		// 写http头
-		if _, err = conn.Write(buf.Bytes()); err != nil {
-			notifyErrC <- fmt.Errorf("Write http header err, %v", err)
-			return
+	// 每次都从文件开头读取, 重试时可以重新发送
+	readFile := sectionBody(f, 0, fileSize)
+	newBody := func() (io.Reader, error) {
+		body, err := readFile()
+		if err != nil {
+			return nil, err
 		}
-
-		// 写body内容
-		f.Seek(0, os.SEEK_SET)
-		chunk := make([]byte, 8192)
-		for {
-			if n, err = f.Read(chunk); err != nil {
-				if err == io.EOF {
-					break
-				}
-				notifyErrC <- fmt.Errorf("Read %s err, %v", r.filePath, err)
-				return
-			}
-			if n <= 0 {
-				break
+		if len(seed) > 0 {
+			sr, err := NewStreamingReader(body, p.SecretKey, p.Region, req.Header.Get("X-Amz-Date"), seed)
+			if err != nil {
+				return nil, fmt.Errorf("New streaming reader err, %v", err)
 			}
+			body = sr
+		}
+		return &progressReader{r: body, total: bodySize, progress: r.setProgress}, nil
+	}
 
-			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-			if n, err = conn.Write(chunk[:n]); err != nil {
-				notifyErrC <- fmt.Errorf("Send err, %v", err)
-				return
-			}
-			writeCount += int64(n)
+	req.Header.Set("Accept-Encoding", "identity")
+	if err = setBody(req, bodySize, newBody); err != nil {
+		poresp.err = err
+		return poresp
+	}
 
-			// 记录进度
-			if r.enableProgress {
-				now := time.Now()
-				if now.Sub(lastUpdateTime) < time.Second {
-					continue
-				}
-				if fileSize > 0 {
-					r.progress.Store(float64(writeCount * int64(100) / fileSize))
-					lastUpdateTime = now
-				}
-			}
-		}
-		if _, err = conn.Write([]byte("\r\n")); err != nil {
-			notifyErrC <- fmt.Errorf("Send err, %v", err)
-			return
-		}
-		if r.enableProgress {
-			r.progress.Store(float64(100))
-		}
-	}(&wg)
+	resp, err := p.do(req)
+	if err != nil {
+		poresp.err = fmt.Errorf("Do request err, %w", err)
+		return poresp
+	}
+	defer resp.Body.Close()
 
-	// 解析返回
-	var (
-		resp    *http.Response
-		loop    = true
-		timeout = time.NewTimer(100 * 365 * 24 * time.Hour)
-	)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		poresp.err = fmt.Errorf("Read response body err, %v", err)
+		return poresp
+	}
 
-	for loop {
-		select {
-		case poresp.err = <-notifyErrC:
-			loop = false
-		case <-writeDoneC:
-			timeout.Reset(5 * time.Second)
-			// don't stop loop
-		case <-timeout.C:
-			poresp.err = errors.New("Read response timeout")
-			loop = false
-		case resp = <-respBufC:
-			if resp.StatusCode < 200 {
-				// continue receive
-				break
-			}
+	if resp.StatusCode != 200 {
+		poresp.err = newS3Error(resp, respBody)
+		return poresp
+	}
+	r.setProgress(float64(100))
 
-			loop = false
+	if r.genUrl {
+		download, err := GenDownloadUrl(r.bucket, r.objName, p, r.signed, r.expired)
+		if err != nil {
+			poresp.err = errors.New("Generate download url failed")
+			return poresp
+		}
+		poresp.DownloadUrl = download
+	}
 
-			respBody, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				poresp.err = fmt.Errorf("Read response body err, %v", err)
-				break
-			}
+	poresp.ETag = strings.Trim(resp.Header.Get("ETag"), "\"")
+	poresp.Base64Md5 = md5
+	return poresp
+}
 
-			if resp.StatusCode != 200 {
-				poresp.err = errors.New(string(respBody))
-				break
-			}
+func (r *PutObjRequest) setProgress(v float64) {
+	if !r.enableProgress {
+		return
+	}
+	r.progress.Store(v)
+}
 
-			if r.genUrl {
-				download, err := GenDownloadUrl(r.bucket, r.objName, p, r.signed, r.expired)
-				if err != nil {
-					poresp.err = errors.New("Generate download url failed")
-					break
-				}
-				poresp.DownloadUrl = download
-			}
+// doMultipart: 使用MultipartPutObjRequest上传, 此时不计算整个文件的md5
+func (r *PutObjRequest) doMultipart(p *RequestParam) Response {
+	var poresp = &PutObjResponse{}
 
-			poresp.ETag = strings.Trim(resp.Header.Get("ETag"), "\"")
-			poresp.Base64Md5 = md5
+	mp := NewMultipartPutObjRequest(r.bucket, r.objName, r.filePath).SetCheckpoint(r.resumable)
+	mp.SetContentType(r.getContentType())
+	header := r.header.Clone()
+	r.acl.setHeader(header)
+	for k := range header {
+		mp.SetHeader(k, header.Get(k))
+	}
+	if r.partSize > 0 {
+		mp.SetPartSize(r.partSize)
+	}
+	if r.workers > 0 {
+		mp.SetWorkers(r.workers)
+	}
+	if r.enableProgress {
+		mp.SetEnableProgress(true)
+		mp.onProgress = func(v float64) {
+			r.progress.Store(v)
 		}
+	}
 
-		if resp != nil {
-			resp.Body.Close()
-		}
+	mpresp := mp.Do(p)
+	if err := mpresp.Err(); err != nil {
+		poresp.err = err
+		return poresp
 	}
 
-	atomic.AddInt32(&stopped, int32(1))
-	wg.Wait()
+	if r.genUrl {
+		download, err := GenDownloadUrl(r.bucket, r.objName, p, r.signed, r.expired)
+		if err != nil {
+			poresp.err = errors.New("Generate download url failed")
+			return poresp
+		}
+		poresp.DownloadUrl = download
+	}
 
+	poresp.ETag = mpresp.(*MultipartPutObjResponse).ETag
 	return poresp
 }
 
 type PutObjResponse struct {
 	ETag        string
-	Base64Md5   string
+	Base64Md5   string // 分块上传时为空
 	DownloadUrl string
 
 	err error
@@ -316,6 +369,31 @@ func (r PutObjResponse) Err() error {
 	return r.err
 }
 
+// conditions: GET | HEAD对象时的条件请求头
+// If-Match | If-Unmodified-Since不满足时服务端返回412, If-None-Match | If-Modified-Since不满足时返回304
+// 可以通过IsPreconditionFailed | IsNotModified判断
+type conditions struct {
+	ifMatch           string
+	ifNoneMatch       string
+	ifModifiedSince   time.Time
+	ifUnmodifiedSince time.Time
+}
+
+func (c *conditions) setHeader(h http.Header) {
+	if len(c.ifMatch) > 0 {
+		h.Set("If-Match", c.ifMatch)
+	}
+	if len(c.ifNoneMatch) > 0 {
+		h.Set("If-None-Match", c.ifNoneMatch)
+	}
+	if !c.ifModifiedSince.IsZero() {
+		h.Set("If-Modified-Since", c.ifModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if !c.ifUnmodifiedSince.IsZero() {
+		h.Set("If-Unmodified-Since", c.ifUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+}
+
 //////////////////////////////////////////////////////////////////
 type GetObjRequest struct {
 	tp int
@@ -337,9 +415,25 @@ type GetObjRequest struct {
 	// 对象大小
 	objSize int64
 
+	// [optional] 只下载部分内容, 保存的文件只包含Range内的数据
+	rng *Range
+	// [optional] ETag或者http.TimeFormat格式的时间, 对象已经变化时服务端返回全部内容, 此时返回错误
+	ifRange string
+
+	// 需要下载的内容在对象中的起始位置和长度, 未设置rng时为整个对象
+	start  int64
+	length int64
+
 	// 下载进度
 	enableProgress bool
 	progress       atomic.Value // float64 [0,100]
+
+	// 是否开启断点续传, 默认false
+	// 开启后下载失败时保留临时文件，再次下载时从临时文件末尾继续
+	resumable bool
+
+	// [optional] 条件下载, 获取对象信息和下载时都会带上
+	conds conditions
 }
 
 func NewGetObjRequest(bucket, objName, savePath string) *GetObjRequest {
@@ -364,6 +458,50 @@ func (r *GetObjRequest) SetBase64Md5(v string) *GetObjRequest {
 	return r
 }
 
+// SetResumable: 开启断点续传, 临时文件为savePath + DownloadTempSuffix
+// 同时在savePath + DownloadTempSuffix + DownloadETagSuffix记录对象的ETag, 对象变化后重新下载
+func (r *GetObjRequest) SetResumable(enable bool) *GetObjRequest {
+	r.resumable = enable
+	return r
+}
+
+// SetRange: 只下载[start, end]字节, end<0表示到对象末尾
+func (r *GetObjRequest) SetRange(start, end int64) *GetObjRequest {
+	r.rng = &Range{Start: start, End: end}
+	return r
+}
+
+// SetSuffixRange: 只下载最后n个字节
+func (r *GetObjRequest) SetSuffixRange(n int64) *GetObjRequest {
+	r.rng = &Range{Suffix: n}
+	return r
+}
+
+func (r *GetObjRequest) SetIfRange(v string) *GetObjRequest {
+	r.ifRange = v
+	return r
+}
+
+func (r *GetObjRequest) SetIfMatch(etag string) *GetObjRequest {
+	r.conds.ifMatch = etag
+	return r
+}
+
+func (r *GetObjRequest) SetIfNoneMatch(etag string) *GetObjRequest {
+	r.conds.ifNoneMatch = etag
+	return r
+}
+
+func (r *GetObjRequest) SetIfModifiedSince(t time.Time) *GetObjRequest {
+	r.conds.ifModifiedSince = t
+	return r
+}
+
+func (r *GetObjRequest) SetIfUnmodifiedSince(t time.Time) *GetObjRequest {
+	r.conds.ifUnmodifiedSince = t
+	return r
+}
+
 func (r *GetObjRequest) SetEnableProgress(enable bool) *GetObjRequest {
 	r.enableProgress = enable
 	r.progress.Store(float64(0))
@@ -410,42 +548,24 @@ func (r *GetObjRequest) getByURL(p *RequestParam) Response {
 
 	// 获取对象信息
 	getInfoReq := NewGetObjInfoByUrlRequest(r.url)
+	getInfoReq.conds = r.conds
 	getInfoResp := getInfoReq.Do(p)
 	if err := getInfoResp.Err(); err != nil {
-		goresp.err = fmt.Errorf("Get object info err, %v", err)
-		return goresp
-	}
-	r.objSize = getInfoResp.(*GetObjInfoResponse).Size
-
-	// 发送获取对象请求
-	req, err := http.NewRequest("GET", r.url, nil)
-	if err != nil {
-		goresp.err = fmt.Errorf("New http request err, %v", err)
+		goresp.err = fmt.Errorf("Get object info err, %w", err)
 		return goresp
 	}
-
-	req.Header.Set("Date", GMTime())
-	req.Header.Set("Accept-Encoding", "identity")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		goresp.err = fmt.Errorf("Do request err, %v", err)
-		return goresp
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		goresp.err = errors.New(string(body))
+	info := getInfoResp.(*GetObjInfoResponse)
+	if !info.IsExisted {
+		goresp.err = fmt.Errorf("Get object info err, %w", errNoSuchKey())
 		return goresp
 	}
-
-	// 保存对象文件到本地
-	if err = r.save(r.savePath, resp.Body); err != nil {
+	if err := r.resolveRange(info.Size); err != nil {
 		goresp.err = err
 		return goresp
 	}
 
+	// 下载并保存对象文件到本地
+	goresp.err = r.download(p, quoteETag(info.ETag))
 	return goresp
 }
 
@@ -454,58 +574,182 @@ func (r *GetObjRequest) getByName(p *RequestParam) Response {
 
 	// 获取对象信息
 	getInfoReq := NewGetObjInfoRequest(r.bucket, r.objName)
+	getInfoReq.conds = r.conds
 	getInfoResp := getInfoReq.Do(p)
 	if err := getInfoResp.Err(); err != nil {
-		goresp.err = fmt.Errorf("Get object info err, %v", err)
+		goresp.err = fmt.Errorf("Get object info err, %w", err)
+		return goresp
+	}
+	info := getInfoResp.(*GetObjInfoResponse)
+	if !info.IsExisted {
+		goresp.err = fmt.Errorf("Get object info err, %w", errNoSuchKey())
+		return goresp
+	}
+	if err := r.resolveRange(info.Size); err != nil {
+		goresp.err = err
 		return goresp
 	}
-	r.objSize = getInfoResp.(*GetObjInfoResponse).Size
 
-	// 发送获取对象请求
-	url := fmt.Sprintf("http://%s/%s/%s", p.Host, r.bucket, r.objName)
-	req, err := http.NewRequest("GET", url, nil)
+	// 下载并保存对象文件到本地
+	goresp.err = r.download(p, quoteETag(info.ETag))
+	return goresp
+}
+
+// resolveRange: 根据对象大小计算需要下载的范围
+func (r *GetObjRequest) resolveRange(objSize int64) error {
+	r.objSize = objSize
+	r.start, r.length = 0, objSize
+	if r.rng == nil {
+		return nil
+	}
+
+	start, end, err := r.rng.resolve(objSize)
 	if err != nil {
-		goresp.err = fmt.Errorf("New http request err, %v", err)
-		return goresp
+		return err
+	}
+	r.start, r.length = start, end-start+1
+	return nil
+}
+
+// newGetReq: 构造获取对象的请求, offset>0时只获取下载范围内offset之后的内容, 并且要求对象的ETag未变化
+func (r *GetObjRequest) newGetReq(p *RequestParam, offset int64, etag string) (*http.Request, error) {
+	url := r.url
+	if r.tp == TypeByName {
+		url = p.objectURL(r.bucket, r.objName, "")
+	}
+	req, err := http.NewRequestWithContext(p.Context(), "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("New http request err, %v", err)
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, Signature(p.SecretKey, req)))
+	r.conds.setHeader(req.Header)
+	if r.rng != nil || offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.start+offset, r.start+r.length-1))
+	}
+	if r.rng != nil && len(r.ifRange) > 0 {
+		req.Header.Set("If-Range", r.ifRange)
+	}
+	if offset > 0 && len(etag) > 0 {
+		req.Header.Set("If-Match", etag)
+	}
+	if r.tp == TypeByName {
+		p.Sign(req, EmptyPayloadSHA256)
+	}
+	return req, nil
+}
+
+// download: 获取对象内容并保存到r.savePath
+// 开启断点续传时，从临时文件的末尾继续下载; 对象或者下载范围已经变化时从头开始下载
+// 续传过程中对象发生变化时删除临时文件并返回PreconditionFailed, 再次下载时从头开始
+func (r *GetObjRequest) download(p *RequestParam, etag string) error {
+	var offset int64
+	if r.resumable {
+		record := etag
+		if r.rng != nil {
+			record = fmt.Sprintf("%s bytes=%d-%d", etag, r.start, r.start+r.length-1)
+		}
+		offset = r.resumeOffset(record)
+		if err := ioutil.WriteFile(r.tmpPath()+DownloadETagSuffix, []byte(record), 0644); err != nil {
+			return fmt.Errorf("Save download etag err, %v", err)
+		}
+	}
+
+	// 临时文件已经完整，只需要校验和重命名
+	if offset > 0 && offset == r.length {
+		return r.save(r.savePath, strings.NewReader(""), offset)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	req, err := r.newGetReq(p, offset, etag)
 	if err != nil {
-		goresp.err = fmt.Errorf("Do request err, %v", err)
-		return goresp
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	resp, err := p.do(req)
+	if err != nil {
+		return fmt.Errorf("Do request err, %w", err)
+	}
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPreconditionFailed:
+		// 获取信息之后对象又发生了变化, 大小和ETag都已经失效, 删除临时文件后返回PreconditionFailed
 		body, _ := ioutil.ReadAll(resp.Body)
-		goresp.err = errors.New(string(body))
-		return goresp
+		resp.Body.Close()
+		os.Remove(r.tmpPath())
+		os.Remove(r.tmpPath() + DownloadETagSuffix)
+		return newS3Error(resp, body)
+	case r.rng != nil && resp.StatusCode == 200:
+		// If-Range不满足(对象已经变化)或者服务端忽略了Range, 返回的是整个对象
+		resp.Body.Close()
+		return errors.New("Range is not satisfied, server returned the whole object")
+	case offset > 0 && resp.StatusCode == 200:
+		// 服务端忽略了Range, 返回的是整个对象
+		offset = 0
+	case (r.rng != nil || offset > 0) && resp.StatusCode == 206:
+	case offset == 0 && resp.StatusCode == 200:
+	default:
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return newS3Error(resp, body)
 	}
 
-	// 保存对象文件到本地
-	if err = r.save(r.savePath, resp.Body); err != nil {
-		goresp.err = err
-		return goresp
+	err = r.save(r.savePath, resp.Body, offset)
+	resp.Body.Close()
+	return err
+}
+
+// resumeOffset: 根据临时文件和记录的ETag(以及下载范围)计算续传的起始位置, 已经变化时返回0
+func (r *GetObjRequest) resumeOffset(record string) int64 {
+	if len(record) <= 0 {
+		return 0
 	}
 
-	return goresp
+	recorded, err := ioutil.ReadFile(r.tmpPath() + DownloadETagSuffix)
+	if err != nil || string(recorded) != record {
+		return 0
+	}
+
+	info, err := os.Stat(r.tmpPath())
+	if err != nil || info.Size() > r.length {
+		return 0
+	}
+	return info.Size()
 }
 
-func (r *GetObjRequest) save(savePath string, src io.Reader) error {
+func (r *GetObjRequest) tmpPath() string {
+	return r.savePath + DownloadTempSuffix
+}
+
+// save: 把src写入临时文件的offset处, 完成后重命名为savePath
+// 开启断点续传时，写入失败会保留临时文件供下次继续
+func (r *GetObjRequest) save(savePath string, src io.Reader, offset int64) error {
 	savePath, _ = filepath.Abs(savePath)
-	tmpPath := r.savePath + ".download"
+	tmpPath := r.tmpPath()
+
+	// 数据校验失败时临时文件不可用, 必需删除
+	var corrupted bool
 
 	saveErr := func() error {
-		f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		flag := os.O_RDWR | os.O_CREATE
+		if offset <= 0 {
+			flag |= os.O_TRUNC
+		}
+		f, err := os.OpenFile(tmpPath, flag, 0644)
 		if err != nil {
 			return fmt.Errorf("Open file %s err, %v", tmpPath, err)
 		}
 		defer f.Close()
 
+		if offset > 0 {
+			if err = f.Truncate(offset); err != nil {
+				return fmt.Errorf("Truncate file %s err, %v", tmpPath, err)
+			}
+			if _, err = f.Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("Seek file %s err, %v", tmpPath, err)
+			}
+		}
+
 		// 启用进度显示
 		var stopC chan struct{}
 		defer func() {
@@ -526,8 +770,8 @@ func (r *GetObjRequest) save(savePath string, src io.Reader) error {
 						if err == nil {
 							continue
 						}
-						if r.objSize > 0 {
-							r.progress.Store(float64((info.Size() - 1) * int64(100) / r.objSize))
+						if r.length > 0 {
+							r.progress.Store(float64((info.Size() - 1) * int64(100) / r.length))
 						}
 					}
 				}
@@ -539,8 +783,8 @@ func (r *GetObjRequest) save(savePath string, src io.Reader) error {
 			return fmt.Errorf("Write file content err, %v", err)
 		}
 
-		if written != r.objSize {
-			return fmt.Errorf("Loss of data during writing, %d bytes written, %d is needed", written, r.objSize)
+		if offset+written != r.length {
+			return fmt.Errorf("Loss of data during writing, %d bytes written, %d is needed", offset+written, r.length)
 		}
 
 		if err = f.Sync(); err != nil {
@@ -553,6 +797,7 @@ func (r *GetObjRequest) save(savePath string, src io.Reader) error {
 				return fmt.Errorf("Cal Base64MD5 err, %v", err)
 			}
 			if b64Md5 != r.base64Md5 {
+				corrupted = true
 				return errors.New("Base64Md5 not equal")
 			}
 		}
@@ -563,7 +808,10 @@ func (r *GetObjRequest) save(savePath string, src io.Reader) error {
 		return nil
 	}()
 
-	if saveErr != nil {
+	if saveErr == nil || !r.resumable || corrupted {
+		os.Remove(tmpPath + DownloadETagSuffix)
+	}
+	if saveErr != nil && (!r.resumable || corrupted) {
 		os.Remove(tmpPath)
 	}
 	return saveErr
@@ -587,6 +835,9 @@ type GetObjInfoRequest struct {
 	// 当tp==TypeByName时必需
 	bucket  string
 	objName string
+
+	// [optional] 条件请求
+	conds conditions
 }
 
 func NewGetObjInfoRequest(bucket, objName string) *GetObjInfoRequest {
@@ -604,6 +855,26 @@ func NewGetObjInfoByUrlRequest(url string) *GetObjInfoRequest {
 	}
 }
 
+func (r *GetObjInfoRequest) SetIfMatch(etag string) *GetObjInfoRequest {
+	r.conds.ifMatch = etag
+	return r
+}
+
+func (r *GetObjInfoRequest) SetIfNoneMatch(etag string) *GetObjInfoRequest {
+	r.conds.ifNoneMatch = etag
+	return r
+}
+
+func (r *GetObjInfoRequest) SetIfModifiedSince(t time.Time) *GetObjInfoRequest {
+	r.conds.ifModifiedSince = t
+	return r
+}
+
+func (r *GetObjInfoRequest) SetIfUnmodifiedSince(t time.Time) *GetObjInfoRequest {
+	r.conds.ifUnmodifiedSince = t
+	return r
+}
+
 func (r *GetObjInfoRequest) Do(p *RequestParam) Response {
 	var goiresp = &GetObjInfoResponse{}
 
@@ -633,112 +904,600 @@ func (r *GetObjInfoRequest) Do(p *RequestParam) Response {
 func (r *GetObjInfoRequest) getByURL(p *RequestParam) Response {
 	var goiresp = &GetObjInfoResponse{}
 
-	req, err := http.NewRequest("HEAD", r.url, nil)
+	req, err := http.NewRequestWithContext(p.Context(), "HEAD", r.url, nil)
 	if err != nil {
 		goiresp.err = fmt.Errorf("New http request err, %v", err)
 		return goiresp
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
+	r.conds.setHeader(req.Header)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
-		goiresp.err = fmt.Errorf("Do request err, %v", err)
+		goiresp.err = fmt.Errorf("Do request err, %w", err)
 		return goiresp
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		goiresp.err = fmt.Errorf("Response StatusCode(%d) != 200", resp.StatusCode)
-		return goiresp
-	}
-
-	l, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
-
-	goiresp.Size = l
-	goiresp.LastModified = resp.Header.Get("Last-Modified")
-	goiresp.ETag = resp.Header.Get("ETag")
-
+	goiresp.parse(resp)
 	return goiresp
 }
 
 func (r *GetObjInfoRequest) getByName(p *RequestParam) Response {
 	var goiresp = &GetObjInfoResponse{}
 
-	url := fmt.Sprintf("http://%s/%s/%s", p.Host, r.bucket, r.objName)
-	req, err := http.NewRequest("HEAD", url, nil)
+	url := p.objectURL(r.bucket, r.objName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "HEAD", url, nil)
 	if err != nil {
 		goiresp.err = fmt.Errorf("New http request err, %v", err)
 		return goiresp
 	}
 
-	req.Header.Set("Date", GMTime())
+	req.Header.Set("Date", p.date())
 	req.Header.Set("Accept-Encoding", "identity")
-	req.Header.Set("Authorization", fmt.Sprintf("%s %s:%s", "AWS", p.AccessKey, Signature(p.SecretKey, req)))
+	r.conds.setHeader(req.Header)
+	p.Sign(req, EmptyPayloadSHA256)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
-		goiresp.err = fmt.Errorf("Do request err, %v", err)
+		goiresp.err = fmt.Errorf("Do request err, %w", err)
 		return goiresp
 	}
 	defer resp.Body.Close()
 
+	goiresp.parse(resp)
+	return goiresp
+}
+
+// GetObjInfoResponse: 对象不存在(404)时IsExisted为false且Err()为nil, 其他字段均为零值
+type GetObjInfoResponse struct {
+	IsExisted bool
+
+	Size         int64
+	LastModified time.Time
+	ETag         string // 去掉了引号
+	// ETag是否为分块上传生成的(形如"xxx-N"), 此时ETag不是对象内容的md5
+	IsMultipartETag bool
+	// 分块上传的分块数, 不是分块上传时为0
+	PartsCount int
+
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	Metadata           map[string]string // x-amz-meta-*, key为去掉前缀后的小写形式
+
+	StorageClass      string // 服务端没有返回时为STANDARD
+	VersionId         string
+	ReplicationStatus string
+
+	// 对象锁定
+	ObjectLockMode            string // GOVERNANCE | COMPLIANCE
+	ObjectLockRetainUntilDate time.Time
+	ObjectLockLegalHold       string // ON | OFF
+
+	Header http.Header
+
+	err error
+}
+
+// parse: 解析HEAD对象的响应, 200以外的状态码除404外都作为错误
+// 条件请求不满足时错误码为NotModified | PreconditionFailed
+func (r *GetObjInfoResponse) parse(resp *http.Response) {
+	if resp.StatusCode == http.StatusNotFound {
+		r.IsExisted = false
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		r.err = newHeadObjectError(resp)
+		return
+	}
+
+	h := resp.Header
+	r.IsExisted = true
+	r.Size, _ = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	r.LastModified, _ = http.ParseTime(h.Get("Last-Modified"))
+	r.ETag = strings.Trim(h.Get("ETag"), "\"")
+	r.PartsCount = multipartETagParts(r.ETag)
+	r.IsMultipartETag = r.PartsCount > 0
+
+	r.ContentType = h.Get("Content-Type")
+	r.ContentEncoding = h.Get("Content-Encoding")
+	r.ContentDisposition = h.Get("Content-Disposition")
+	r.CacheControl = h.Get("Cache-Control")
+	r.Metadata = UserMetadata(h)
+
+	r.StorageClass = h.Get("X-Amz-Storage-Class")
+	if len(r.StorageClass) <= 0 {
+		r.StorageClass = "STANDARD"
+	}
+	r.VersionId = h.Get("X-Amz-Version-Id")
+	r.ReplicationStatus = h.Get("X-Amz-Replication-Status")
+
+	r.ObjectLockMode = h.Get("X-Amz-Object-Lock-Mode")
+	r.ObjectLockRetainUntilDate, _ = time.Parse(time.RFC3339, h.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	r.ObjectLockLegalHold = h.Get("X-Amz-Object-Lock-Legal-Hold")
+
+	r.Header = h
+}
+
+// multipartETagParts: 分块上传的ETag为"md5(各分块md5)-分块数", 返回分块数, 不是分块上传的ETag时返回0
+func multipartETagParts(etag string) int {
+	idx := strings.LastIndex(etag, "-")
+	if idx <= 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(etag[idx+1:])
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n
+}
+
+func (r GetObjInfoResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+type DeleteObjRequest struct {
+	bucket  string // [required]
+	objName string // [required]
+
+	// [optional] 删除指定版本，为空时删除最新版本(多版本bucket中会生成删除标记)
+	versionId string
+}
+
+func NewDeleteObjRequest(bucket, objName string) *DeleteObjRequest {
+	return &DeleteObjRequest{
+		bucket:  bucket,
+		objName: objName,
+	}
+}
+
+func (r *DeleteObjRequest) SetVersionId(versionId string) *DeleteObjRequest {
+	r.versionId = versionId
+	return r
+}
+
+func (r *DeleteObjRequest) Do(p *RequestParam) Response {
+	var doresp = &DeleteObjResponse{}
+
+	// 参数校验
+	if p == nil {
+		doresp.err = errors.New("Nil RequestParam")
+		return doresp
+	}
+	if err := p.Validate(); err != nil {
+		doresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return doresp
+	}
+
+	// 发送请求
+	url := p.objectURL(r.bucket, r.objName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "DELETE", url, nil)
+	if err != nil {
+		doresp.err = fmt.Errorf("New http request err, %v", err)
+		return doresp
+	}
+	if len(r.versionId) > 0 {
+		query := req.URL.Query()
+		query.Set("versionId", r.versionId)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		doresp.err = fmt.Errorf("Do request err, %w", err)
+		return doresp
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		doresp.err = newS3Error(resp, body)
+		return doresp
+	}
+
+	doresp.VersionId = resp.Header.Get("x-amz-version-id")
+	doresp.DeleteMarker = resp.Header.Get("x-amz-delete-marker") == "true"
+	return doresp
+}
+
+type DeleteObjResponse struct {
+	VersionId    string
+	DeleteMarker bool
+
+	err error
+}
+
+func (r DeleteObjResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+// 单次批量删除最多支持的对象个数
+const MaxDeleteObjs = 1000
+
+type ObjectIdentifier struct {
+	XMLName   xml.Name `xml:"Object"`
+	Key       string   `xml:"Key"`
+	VersionId string   `xml:"VersionId,omitempty"`
+}
+
+type deleteObjsBody struct {
+	XMLName xml.Name           `xml:"Delete"`
+	Quiet   bool               `xml:"Quiet,omitempty"`
+	Objects []ObjectIdentifier `xml:"Object"`
+}
+
+type DeletedObject struct {
+	Key                   string `xml:"Key"`
+	VersionId             string `xml:"VersionId"`
+	DeleteMarker          bool   `xml:"DeleteMarker"`
+	DeleteMarkerVersionId string `xml:"DeleteMarkerVersionId"`
+}
+
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionId string `xml:"VersionId"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+func (e DeleteError) Error() string {
+	return fmt.Sprintf("Delete %s err, %s: %s", e.Key, e.Code, e.Message)
+}
+
+type deleteObjsResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Deleted []DeletedObject `xml:"Deleted"`
+	Errors  []DeleteError   `xml:"Error"`
+}
+
+// DeleteObjsRequest: 批量删除对象, 超过1000个时自动拆分为多次请求
+type DeleteObjsRequest struct {
+	bucket string             // [required]
+	objs   []ObjectIdentifier // [required]
+
+	// quiet模式下服务端只返回删除失败的对象
+	quiet bool
+}
+
+func NewDeleteObjsRequest(bucket string, objNames ...string) *DeleteObjsRequest {
+	r := &DeleteObjsRequest{
+		bucket: bucket,
+		objs:   make([]ObjectIdentifier, 0, len(objNames)),
+	}
+	for _, name := range objNames {
+		r.AddObj(name, "")
+	}
+	return r
+}
+
+// @param versionId: 可选，为空时删除最新版本
+func (r *DeleteObjsRequest) AddObj(objName, versionId string) *DeleteObjsRequest {
+	r.objs = append(r.objs, ObjectIdentifier{Key: objName, VersionId: versionId})
+	return r
+}
+
+func (r *DeleteObjsRequest) SetQuiet(quiet bool) *DeleteObjsRequest {
+	r.quiet = quiet
+	return r
+}
+
+func (r *DeleteObjsRequest) Do(p *RequestParam) Response {
+	var dosresp = &DeleteObjsResponse{}
+
+	// 参数校验
+	if p == nil {
+		dosresp.err = errors.New("Nil RequestParam")
+		return dosresp
+	}
+	if err := p.Validate(); err != nil {
+		dosresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return dosresp
+	}
+
+	// 按照每次最多1000个拆分
+	for start := 0; start < len(r.objs); start += MaxDeleteObjs {
+		end := start + MaxDeleteObjs
+		if end > len(r.objs) {
+			end = len(r.objs)
+		}
+
+		result, err := r.deleteChunk(p, r.objs[start:end])
+		if err != nil {
+			dosresp.err = err
+			return dosresp
+		}
+		dosresp.Deleted = append(dosresp.Deleted, result.Deleted...)
+		dosresp.Errors = append(dosresp.Errors, result.Errors...)
+	}
+
+	return dosresp
+}
+
+func (r *DeleteObjsRequest) deleteChunk(p *RequestParam, objs []ObjectIdentifier) (*deleteObjsResult, error) {
+	body, err := xml.Marshal(deleteObjsBody{Quiet: r.quiet, Objects: objs})
+	if err != nil {
+		return nil, fmt.Errorf("Marshal delete body err, %v", err)
+	}
+	md5sum := md5.Sum(body)
+
+	// 发送请求
+	url := p.objectURL(r.bucket, "", "delete")
+	req, err := http.NewRequestWithContext(p.Context(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("New http request err, %v", err)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	p.Sign(req, HexSHA256(body))
+
+	// 重复删除同一批对象的结果相同, 可以安全重试
+	resp, err := p.do(markIdempotent(req))
+	if err != nil {
+		return nil, fmt.Errorf("Do request err, %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Read response body err, %v", err)
+	}
+
 	if resp.StatusCode != 200 {
-		goiresp.err = fmt.Errorf("Response StatusCode(%d) != 200", resp.StatusCode)
-		return goiresp
+		return nil, newS3Error(resp, respBody)
 	}
 
-	l, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	result := &deleteObjsResult{}
+	if err = xml.Unmarshal(respBody, result); err != nil {
+		return nil, fmt.Errorf("Unmarshal response body err, %v", err)
+	}
+	return result, nil
+}
 
-	goiresp.Size = l
-	goiresp.LastModified = resp.Header.Get("Last-Modified")
-	goiresp.ETag = resp.Header.Get("ETag")
+type DeleteObjsResponse struct {
+	// quiet模式下Deleted为空
+	Deleted []DeletedObject
+	Errors  []DeleteError
 
-	return goiresp
+	err error
 }
 
-type GetObjInfoResponse struct {
-	Size         int64
-	LastModified string
+func (r DeleteObjsResponse) Err() error {
+	return r.err
+}
+
+//////////////////////////////////////////////////////////////////
+// 复制对象时元数据的处理方式
+const (
+	MetadataDirectiveCopy    = "COPY"    // 使用源对象的元数据
+	MetadataDirectiveReplace = "REPLACE" // 使用请求中指定的元数据
+)
+
+type CopyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+// CopyObjRequest: 服务端复制对象, 数据不经过客户端
+type CopyObjRequest struct {
+	srcBucket  string // [required]
+	srcObjName string // [required]
+	dstBucket  string // [required]
+	dstObjName string // [required]
+
+	// [optional] 复制源对象的指定版本
+	srcVersionId string
+
+	// [optional] COPY | REPLACE, 默认COPY
+	metadataDirective string
+	// 当metadataDirective为REPLACE时生效
+	contentType string
+	metadata    map[string]string
+
+	// [optional] 条件复制, 不满足时返回412
+	ifMatch           string
+	ifNoneMatch       string
+	ifModifiedSince   time.Time
+	ifUnmodifiedSince time.Time
+}
+
+func NewCopyObjRequest(srcBucket, srcObjName, dstBucket, dstObjName string) *CopyObjRequest {
+	return &CopyObjRequest{
+		srcBucket:         srcBucket,
+		srcObjName:        srcObjName,
+		dstBucket:         dstBucket,
+		dstObjName:        dstObjName,
+		metadataDirective: MetadataDirectiveCopy,
+		metadata:          make(map[string]string),
+	}
+}
+
+func (r *CopyObjRequest) SetSrcVersionId(versionId string) *CopyObjRequest {
+	r.srcVersionId = versionId
+	return r
+}
+
+// SetMetadataDirective: MetadataDirectiveCopy | MetadataDirectiveReplace
+func (r *CopyObjRequest) SetMetadataDirective(directive string) *CopyObjRequest {
+	r.metadataDirective = directive
+	return r
+}
+
+// SetContentType: 设置新对象的Content-Type, 需要MetadataDirectiveReplace
+func (r *CopyObjRequest) SetContentType(contentType string) *CopyObjRequest {
+	r.contentType = contentType
+	return r
+}
+
+// SetMetadata: 设置新对象的x-amz-meta-*, 需要MetadataDirectiveReplace
+// @param k: 不带x-amz-meta-前缀
+func (r *CopyObjRequest) SetMetadata(k, v string) *CopyObjRequest {
+	r.metadata[k] = v
+	return r
+}
+
+func (r *CopyObjRequest) SetIfMatch(etag string) *CopyObjRequest {
+	r.ifMatch = etag
+	return r
+}
+
+func (r *CopyObjRequest) SetIfNoneMatch(etag string) *CopyObjRequest {
+	r.ifNoneMatch = etag
+	return r
+}
+
+func (r *CopyObjRequest) SetIfModifiedSince(t time.Time) *CopyObjRequest {
+	r.ifModifiedSince = t
+	return r
+}
+
+func (r *CopyObjRequest) SetIfUnmodifiedSince(t time.Time) *CopyObjRequest {
+	r.ifUnmodifiedSince = t
+	return r
+}
+
+func (r *CopyObjRequest) Do(p *RequestParam) Response {
+	var coresp = &CopyObjResponse{}
+
+	// 参数校验
+	if p == nil {
+		coresp.err = errors.New("Nil RequestParam")
+		return coresp
+	}
+	if err := p.Validate(); err != nil {
+		coresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return coresp
+	}
+	switch r.metadataDirective {
+	case MetadataDirectiveCopy, MetadataDirectiveReplace:
+	default:
+		coresp.err = fmt.Errorf("Unknown metadata directive %s", r.metadataDirective)
+		return coresp
+	}
+
+	// 发送请求
+	url := p.objectURL(r.dstBucket, r.dstObjName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, nil)
+	if err != nil {
+		coresp.err = fmt.Errorf("New http request err, %v", err)
+		return coresp
+	}
+
+	copySource := EncodePath(fmt.Sprintf("/%s/%s", r.srcBucket, r.srcObjName))
+	if len(r.srcVersionId) > 0 {
+		copySource += "?versionId=" + EncodeURI(r.srcVersionId, true)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("X-Amz-Copy-Source", copySource)
+	req.Header.Set("X-Amz-Metadata-Directive", r.metadataDirective)
+	if r.metadataDirective == MetadataDirectiveReplace {
+		if len(r.contentType) > 0 {
+			req.Header.Set("Content-Type", r.contentType)
+		}
+		for k, v := range r.metadata {
+			req.Header.Set("X-Amz-Meta-"+k, v)
+		}
+	}
+	if len(r.ifMatch) > 0 {
+		req.Header.Set("X-Amz-Copy-Source-If-Match", r.ifMatch)
+	}
+	if len(r.ifNoneMatch) > 0 {
+		req.Header.Set("X-Amz-Copy-Source-If-None-Match", r.ifNoneMatch)
+	}
+	if !r.ifModifiedSince.IsZero() {
+		req.Header.Set("X-Amz-Copy-Source-If-Modified-Since", r.ifModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if !r.ifUnmodifiedSince.IsZero() {
+		req.Header.Set("X-Amz-Copy-Source-If-Unmodified-Since", r.ifUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+	p.Sign(req, EmptyPayloadSHA256)
+
+	resp, err := p.do(req)
+	if err != nil {
+		coresp.err = fmt.Errorf("Do request err, %w", err)
+		return coresp
+	}
+	defer resp.Body.Close()
+
+	// 解析响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		coresp.err = fmt.Errorf("Read response body err, %v", err)
+		return coresp
+	}
+
+	// 复制过程中出错时也可能返回200, 此时body为Error
+	if resp.StatusCode != 200 || bytes.Contains(respBody, []byte("<Error>")) {
+		coresp.err = newS3Error(resp, respBody)
+		return coresp
+	}
+
+	var result CopyObjectResult
+	if err = xml.Unmarshal(respBody, &result); err != nil {
+		coresp.err = fmt.Errorf("Unmarshal response body err, %v", err)
+		return coresp
+	}
+
+	coresp.ETag = strings.Trim(result.ETag, "\"")
+	coresp.LastModified = result.LastModified
+	coresp.VersionId = resp.Header.Get("x-amz-version-id")
+	coresp.SrcVersionId = resp.Header.Get("x-amz-copy-source-version-id")
+	return coresp
+}
+
+type CopyObjResponse struct {
 	ETag         string
+	LastModified time.Time
+	VersionId    string
+	SrcVersionId string
 
 	err error
 }
 
-func (r GetObjInfoResponse) Err() error {
+func (r CopyObjResponse) Err() error {
 	return r.err
 }
 
 //////////////////////////////////////////////////////////////////
 // GenDownloadUrl: 生成对象的下载链接
+// 需要PUT、HEAD、DELETE或者自定义响应头的签名链接请使用PresignRequest
 // @param signed  : 是否携带签名
 // @param expired : 下载链接有效时间
 func GenDownloadUrl(bucket, objName string, p *RequestParam, signed bool, expired int64) (string, error) {
 	// 检测object
 	req := NewGetObjInfoRequest(bucket, objName)
 	resp := req.Do(p)
-	if err := resp.Err(); err != nil {
+	if err := resp.Err(); err != nil || !resp.(*GetObjInfoResponse).IsExisted {
 		return "", errors.New("Bad object")
 	}
 
-	bucket = url.PathEscape(bucket)
-	objName = url.PathEscape(objName)
-
-	// 下面生成签名需要依赖这个path
-	path := fmt.Sprintf("http://%s/%s/%s", p.Host, bucket, objName)
-
 	if signed {
-		expiredStr := fmt.Sprintf("%d", time.Now().Add(time.Duration(expired)*time.Second).Unix())
-		req, _ := http.NewRequest("GET", path, nil)
-		req.Header.Set("Expires", expiredStr)
-
-		signature := url.QueryEscape(Signature(p.SecretKey, req))
-		expiredStr = url.QueryEscape(expiredStr)
-
-		path = fmt.Sprintf("http://%s/%s/%s?Signature=%s&Expires=%s&AWSAccessKeyId=%s",
-			p.Host, bucket, objName, signature, expiredStr, p.AccessKey)
+		// 签名方式跟随p.SignVersion
+		presp := NewPresignRequest("GET", bucket, objName).SetExpired(expired).Do(p)
+		if err := presp.Err(); err != nil {
+			return "", err
+		}
+		return presp.(*PresignResponse).Url, nil
 	}
 
-	return path, nil
+	bucket = url.PathEscape(bucket)
+	objName = url.PathEscape(objName)
+
+	return p.objectURL(bucket, objName, ""), nil
 }
@@ -0,0 +1,149 @@
+package ceph
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPresignExpired = 3600
+	MaxPresignExpired     = 7 * 24 * 3600
+)
+
+//////////////////////////////////////////////////////////////////
+// PresignRequest: 生成带签名的URL, 第三方(比如浏览器)无需密钥即可直接访问对象
+// 签名方式跟随RequestParam.SignVersion, V4生成X-Amz-*参数, V2生成Signature&Expires&AWSAccessKeyId参数
+type PresignRequest struct {
+	method  string // [required] GET | PUT | HEAD | DELETE
+	bucket  string // [required]
+	objName string // [required]
+
+	// 有效时间，单位秒，默认3600, V4最长7天
+	expired int64
+
+	// 需要参与签名的头，使用URL的时候必需带上相同的头, 比如PUT时的Content-Type
+	header http.Header
+
+	// 额外的query参数, 比如response-content-disposition
+	query url.Values
+}
+
+func NewPresignRequest(method, bucket, objName string) *PresignRequest {
+	return &PresignRequest{
+		method:  strings.ToUpper(method),
+		bucket:  bucket,
+		objName: objName,
+		expired: DefaultPresignExpired,
+		header:  make(http.Header),
+		query:   make(url.Values),
+	}
+}
+
+// @param expired : URL有效时间，单位秒
+func (r *PresignRequest) SetExpired(expired int64) *PresignRequest {
+	r.expired = expired
+	return r
+}
+
+func (r *PresignRequest) SetHeader(k, v string) *PresignRequest {
+	r.header.Set(k, v)
+	return r
+}
+
+func (r *PresignRequest) SetQuery(k, v string) *PresignRequest {
+	r.query.Set(k, v)
+	return r
+}
+
+// SetResponseHeader: 设置GET时覆盖的响应头, 比如("Content-Disposition", "attachment; filename=a.txt")
+// 对应query参数response-content-disposition
+func (r *PresignRequest) SetResponseHeader(k, v string) *PresignRequest {
+	k = "response-" + strings.ToLower(k)
+	if _, ok := QsaOfInterest[k]; !ok {
+		return r
+	}
+	return r.SetQuery(k, v)
+}
+
+func (r *PresignRequest) Do(p *RequestParam) Response {
+	var presp = &PresignResponse{}
+
+	// 参数校验
+	if p == nil {
+		presp.err = errors.New("Nil RequestParam")
+		return presp
+	}
+	if err := p.Validate(); err != nil {
+		presp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return presp
+	}
+
+	switch r.method {
+	case "GET", "PUT", "HEAD", "DELETE":
+	default:
+		presp.err = fmt.Errorf("Unsupported presign method %s", r.method)
+		return presp
+	}
+
+	if len(r.bucket) <= 0 || len(r.objName) <= 0 {
+		presp.err = errors.New("Empty bucket or object name")
+		return presp
+	}
+
+	if r.expired <= 0 {
+		presp.err = fmt.Errorf("Invalid expired %d", r.expired)
+		return presp
+	}
+	if p.SignVersion == SignV4 && r.expired > MaxPresignExpired {
+		presp.err = fmt.Errorf("Expired %d exceeds max %d seconds", r.expired, MaxPresignExpired)
+		return presp
+	}
+
+	u := p.objectURL(r.bucket, r.objName, r.query.Encode())
+	req, err := http.NewRequestWithContext(p.Context(), r.method, u, nil)
+	if err != nil {
+		presp.err = fmt.Errorf("New http request err, %v", err)
+		return presp
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	now := p.now()
+	if p.SignVersion == SignV4 {
+		presp.Url = PresignV4(p.AccessKey, p.SecretKey, p.Region, req, r.expired, now)
+	} else {
+		expiredStr := fmt.Sprintf("%d", now.Add(time.Duration(r.expired)*time.Second).Unix())
+		signature := signatureV2(p.SecretKey, req, p.canonicalResource(req.URL), expiredStr)
+
+		query := req.URL.Query()
+		query.Set("Signature", signature)
+		query.Set("Expires", expiredStr)
+		query.Set("AWSAccessKeyId", p.AccessKey)
+		req.URL.RawPath = EncodePath(req.URL.Path)
+		req.URL.RawQuery = query.Encode()
+		presp.Url = req.URL.String()
+	}
+	presp.Method = r.method
+	presp.Header = req.Header
+
+	return presp
+}
+
+type PresignResponse struct {
+	Url    string
+	Method string
+
+	// 使用Url时需要带上的头
+	Header http.Header
+
+	err error
+}
+
+func (r PresignResponse) Err() error {
+	return r.err
+}
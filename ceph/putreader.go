@@ -0,0 +1,333 @@
+package ceph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////////////////////////////////////////////
+// PutObjFromReaderRequest: 从io.Reader上传对象, 数据不需要落盘
+// 长度已知时使用单个PUT上传; 长度未知时按分块读取，超过一个分块则自动改用分块上传
+type PutObjFromReaderRequest struct {
+	bucket  string    // [required]
+	objName string    // [required]
+	reader  io.Reader // [required]
+
+	// [required] 数据长度, <0表示未知
+	size int64
+
+	// [optional] 预先计算好的base64(md5)，单个PUT上传时作为Content-MD5发送
+	base64Md5 string
+	// [optional] 默认binary/octet-stream
+	contentType string
+	// [optional] 长度未知时每次读取的分块大小, 默认16MB
+	partSize int64
+	// [optional] 单个分块失败后的重试次数, 默认3
+	retries int
+}
+
+// @param size: 数据长度, 未知时传-1
+func NewPutObjFromReaderRequest(bucket, objName string, reader io.Reader, size int64) *PutObjFromReaderRequest {
+	return &PutObjFromReaderRequest{
+		bucket:      bucket,
+		objName:     objName,
+		reader:      reader,
+		size:        size,
+		contentType: "binary/octet-stream",
+		partSize:    DefaultPartSize,
+		retries:     DefaultPartRetries,
+	}
+}
+
+func (r *PutObjFromReaderRequest) SetBase64Md5(v string) *PutObjFromReaderRequest {
+	r.base64Md5 = v
+	return r
+}
+
+func (r *PutObjFromReaderRequest) SetContentType(contentType string) *PutObjFromReaderRequest {
+	r.contentType = contentType
+	return r
+}
+
+func (r *PutObjFromReaderRequest) SetPartSize(size int64) *PutObjFromReaderRequest {
+	r.partSize = size
+	return r
+}
+
+func (r *PutObjFromReaderRequest) SetRetries(n int) *PutObjFromReaderRequest {
+	r.retries = n
+	return r
+}
+
+func (r *PutObjFromReaderRequest) Do(p *RequestParam) Response {
+	var porresp = &PutObjFromReaderResponse{}
+
+	// 参数校验
+	if p == nil {
+		porresp.err = errors.New("Nil RequestParam")
+		return porresp
+	}
+	if err := p.Validate(); err != nil {
+		porresp.err = fmt.Errorf("Validate RequestParam err, %v", err)
+		return porresp
+	}
+	if r.reader == nil {
+		porresp.err = errors.New("Nil reader")
+		return porresp
+	}
+
+	if r.size >= 0 {
+		etag, err := r.putSingle(p, r.reader, r.size, r.base64Md5)
+		if err != nil {
+			porresp.err = err
+			return porresp
+		}
+		porresp.ETag = etag
+		porresp.Size = r.size
+		return porresp
+	}
+
+	if r.partSize < MinPartSize || r.partSize > MaxPartSize {
+		porresp.err = fmt.Errorf("Invalid part size %d", r.partSize)
+		return porresp
+	}
+
+	// 长度未知, 先读取一个分块, 不足一个分块时直接PUT
+	buf := make([]byte, r.partSize)
+	n, err := io.ReadFull(r.reader, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		etag, err := r.putSingle(p, bytes.NewReader(buf[:n]), int64(n), r.base64Md5)
+		if err != nil {
+			porresp.err = err
+			return porresp
+		}
+		porresp.ETag = etag
+		porresp.Size = int64(n)
+		return porresp
+	}
+	if err != nil {
+		porresp.err = fmt.Errorf("Read data err, %v", err)
+		return porresp
+	}
+
+	return r.putMultipart(p, buf)
+}
+
+// putSingle: 使用单个PUT上传size字节
+// V4签名时如果body不支持Seek则无法预先计算sha256, 此时PayloadSigned改用aws-chunked方式签名
+func (r *PutObjFromReaderRequest) putSingle(p *RequestParam, body io.Reader, size int64, base64Md5 string) (string, error) {
+	url := p.objectURL(r.bucket, r.objName, "")
+	req, err := http.NewRequestWithContext(p.Context(), "PUT", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("New http request err, %v", err)
+	}
+
+	req.Header.Set("Date", p.date())
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Content-Type", r.contentType)
+	if len(base64Md5) > 0 {
+		req.Header.Set("Content-MD5", base64Md5)
+	}
+
+	var (
+		seed     string // 流式签名时的seed signature
+		sendSize = size
+	)
+	if p.SignVersion != SignV4 {
+		p.Sign(req, "")
+	} else {
+		mode := p.PayloadMode
+		if mode == PayloadSigned {
+			sha, err := hexSHA256Reader(body, size)
+			switch {
+			case err == errNotSeekable:
+				mode = PayloadStreaming
+			case err != nil:
+				return "", err
+			default:
+				p.Sign(req, sha)
+			}
+		}
+
+		switch mode {
+		case PayloadSigned:
+			// 上面已经签名
+		case PayloadStreaming:
+			req.Header.Set("Content-Encoding", "aws-chunked")
+			req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(size, 10))
+			seed = p.Sign(req, StreamingPayload)
+			sendSize = StreamingContentLength(size)
+		default:
+			p.Sign(req, UnsignedPayload)
+		}
+	}
+	// body支持Seek时每次都从当前位置开始读取, 重试时可以重新发送
+	var rewindable bool
+	readBody := func() (io.Reader, error) {
+		return io.LimitReader(body, size), nil
+	}
+	if rs, ok := body.(io.ReadSeeker); ok {
+		if offset, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			readBody = sectionBody(rs, offset, size)
+			rewindable = true
+		}
+	}
+	newBody := func() (io.Reader, error) {
+		sendBody, err := readBody()
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) <= 0 {
+			return sendBody, nil
+		}
+		sr, err := NewStreamingReader(sendBody, p.SecretKey, p.Region, req.Header.Get("X-Amz-Date"), seed)
+		if err != nil {
+			return nil, fmt.Errorf("New streaming reader err, %v", err)
+		}
+		return sr, nil
+	}
+	if rewindable {
+		if err = setBody(req, sendSize, newBody); err != nil {
+			return "", err
+		}
+	} else if sendSize > 0 {
+		sendBody, err := newBody()
+		if err != nil {
+			return "", err
+		}
+		req.Body = ioutil.NopCloser(sendBody)
+		req.ContentLength = sendSize
+	}
+
+	resp, err := p.do(req)
+	if err != nil {
+		return "", fmt.Errorf("Do request err, %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return "", newS3Error(resp, respBody)
+	}
+
+	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
+}
+
+// putMultipart: 长度未知且超过一个分块时，边读边按分块上传
+// @param first: 已经读取的第一个分块
+func (r *PutObjFromReaderRequest) putMultipart(p *RequestParam, first []byte) Response {
+	var porresp = &PutObjFromReaderResponse{}
+
+	initResp := NewInitMultipartUploadRequest(r.bucket, r.objName).SetContentType(r.contentType).Do(p)
+	if err := initResp.Err(); err != nil {
+		porresp.err = fmt.Errorf("Init multipart upload err, %w", err)
+		return porresp
+	}
+	uploadId := initResp.(*InitMultipartUploadResponse).UploadId
+
+	var (
+		buf        = first
+		n          = len(first)
+		parts      = make([]CompletePart, 0)
+		total      = int64(0)
+		partNumber = 1
+		readErr    error
+	)
+	for n > 0 {
+		if partNumber > MaxPartsCount {
+			NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+			porresp.err = fmt.Errorf("Too many parts, part size %d is too small", r.partSize)
+			return porresp
+		}
+
+		etag, err := r.uploadPart(p, uploadId, partNumber, buf[:n])
+		if err != nil {
+			NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+			porresp.err = fmt.Errorf("Upload part %d err, %w", partNumber, err)
+			return porresp
+		}
+		parts = append(parts, CompletePart{PartNumber: partNumber, ETag: etag})
+		total += int64(n)
+		partNumber++
+
+		if readErr != nil {
+			break
+		}
+		n, readErr = io.ReadFull(r.reader, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+			porresp.err = fmt.Errorf("Read data err, %v", readErr)
+			return porresp
+		}
+	}
+
+	completeResp := NewCompleteMultipartUploadRequest(r.bucket, r.objName, uploadId, parts).Do(p)
+	if err := completeResp.Err(); err != nil {
+		NewAbortMultipartUploadRequest(r.bucket, r.objName, uploadId).Do(p.cleanup())
+		porresp.err = fmt.Errorf("Complete multipart upload err, %w", err)
+		return porresp
+	}
+
+	porresp.ETag = completeResp.(*CompleteMultipartUploadResponse).ETag
+	porresp.UploadId = uploadId
+	porresp.Size = total
+	return porresp
+}
+
+// uploadPart: 上传单个分块, 失败时最多重试r.retries次, 见retryPart
+func (r *PutObjFromReaderRequest) uploadPart(p *RequestParam, uploadId string, partNumber int, data []byte) (string, error) {
+	var etag string
+	err := p.retryPart(r.retries, func() error {
+		resp := NewUploadPartRequest(r.bucket, r.objName, uploadId, partNumber, bytes.NewReader(data), int64(len(data))).Do(p)
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		etag = resp.(*UploadPartResponse).ETag
+		return nil
+	})
+	return etag, err
+}
+
+type PutObjFromReaderResponse struct {
+	ETag     string
+	Size     int64  // 实际上传的字节数
+	UploadId string // 使用分块上传时有效
+
+	err error
+}
+
+func (r PutObjFromReaderResponse) Err() error {
+	return r.err
+}
+
+var errNotSeekable = errors.New("Reader is not seekable")
+
+// hexSHA256Reader: 计算body接下来size字节的sha256并Seek回原位置
+func hexSHA256Reader(body io.Reader, size int64) (string, error) {
+	rs, ok := body.(io.ReadSeeker)
+	if !ok {
+		return "", errNotSeekable
+	}
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", errNotSeekable
+	}
+
+	h := sha256.New()
+	if _, err = io.CopyN(h, rs, size); err != nil {
+		return "", fmt.Errorf("Read data err, %v", err)
+	}
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return "", fmt.Errorf("Seek data err, %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
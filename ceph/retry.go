@@ -0,0 +1,285 @@
+package ceph
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 200 * time.Millisecond
+	DefaultRetryMaxDelay    = 5 * time.Second
+)
+
+// RetryPolicy: 请求失败后的重试策略
+// 只有幂等的请求(GET | HEAD | PUT | DELETE, 以及内部标记为幂等的请求)会在服务端可能已经收到请求后重试
+// 建立连接时的临时错误(超时、连接被拒绝等)说明请求还没有发出, 任何请求都可以重试
+type RetryPolicy struct {
+	// 包括第一次请求在内的最大尝试次数, <=1表示不重试
+	MaxAttempts int
+	// 第一次重试前等待时间的上限, 之后每次翻倍, 实际等待时间在(0, 上限]之间随机
+	BaseDelay time.Duration
+	// 等待时间上限的最大值
+	MaxDelay time.Duration
+
+	// [optional] 判断请求结果是否可以重试, 为nil时使用DefaultRetryable
+	// resp和err只有一个不为nil
+	Retryable func(resp *http.Response, err error) bool
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// DefaultRetryable: 临时的网络错误(超时、连接被重置或拒绝、连接提前关闭)以及429 | 500 | 502 | 503 | 504可以重试
+// 证书校验失败、URL错误等重试也不会成功的错误不重试
+func DefaultRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable, // SlowDown
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransientError: client.Do返回的错误都包装在*url.Error中, 而*url.Error本身实现了net.Error
+// 需要先解开再判断实际的错误
+func isTransientError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	// TLS握手或者证书校验失败
+	var (
+		unknownAuthErr x509.UnknownAuthorityError
+		hostnameErr    x509.HostnameError
+		certInvalidErr x509.CertificateInvalidError
+		recordErr      tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &certInvalidErr) || errors.As(err, &recordErr) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+
+	// 域名不存在时不重试, DNS服务器临时故障可以重试
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (rp *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	// 连接都没有建立, 服务端不可能收到请求
+	var opErr *net.OpError
+	if err != nil && errors.As(err, &opErr) && opErr.Op == "dial" {
+		return isTransientError(err)
+	}
+
+	if !isIdempotent(req) {
+		return false
+	}
+	if rp.Retryable != nil {
+		return rp.Retryable(resp, err)
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// backoff: 第attempt次失败后的等待时间, 使用full jitter
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	d := rp.BaseDelay
+	for i := 1; i < attempt && d < rp.MaxDelay; i++ {
+		d *= 2
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// doWithRetry: 使用client发送请求, 按照rp重试
+func (rp *RetryPolicy) doWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= rp.MaxAttempts || !rp.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		// body已经被读取过, 无法重新获取时直接返回本次结果
+		next, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if ctxErr := sleepContext(req.Context(), rp.backoff(attempt)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		req = next
+	}
+}
+
+// retryPart: 分块上传、分片下载等失败后重试retries次, 只重试RetryPolicy处理不到的错误
+func (p *RequestParam) retryPart(retries int, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if ctxErr := sleepContext(p.Context(), time.Duration(attempt)*time.Second); ctxErr != nil {
+				return ctxErr
+			}
+		}
+		if err = fn(); err == nil || !p.shouldRetryPart(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// shouldRetryPart: 服务端返回的4xx(408 | 429除外)以及ctx取消或者超时, 重试也不会成功
+// 发送请求的错误(*url.Error)和5xx在开启RetryPolicy时已经重试过, 不再叠加重试
+// 读取响应body失败、数据不完整等错误RetryPolicy处理不到, 需要重新请求
+func (p *RequestParam) shouldRetryPart(err error) bool {
+	if p.Context().Err() != nil {
+		return false
+	}
+	policyEnabled := p.Retry != nil && p.Retry.MaxAttempts > 1
+
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) {
+		if s3Err.StatusCode < 500 && s3Err.StatusCode != http.StatusRequestTimeout &&
+			s3Err.StatusCode != http.StatusTooManyRequests {
+			return false
+		}
+		return !policyEnabled
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return !policyEnabled && isTransientError(err)
+	}
+	return true
+}
+
+// rewindRequest: 返回可以再次发送的请求, 有body时通过GetBody重新获取
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errNotRewindable
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, nil
+}
+
+// setBody: 设置请求的body, newBody每次调用都需要返回从头开始的数据, 重试时用来重新发送body
+func setBody(req *http.Request, size int64, newBody func() (io.Reader, error)) error {
+	if size <= 0 {
+		return nil
+	}
+
+	body, err := newBody()
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(body)
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		body, err := newBody()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(body), nil
+	}
+	return nil
+}
+
+// sectionBody: 返回setBody使用的newBody, 每次返回body中[start, start+size)的数据
+// http.Transport在RoundTrip返回后仍可能读取上一次的body, 多次尝试不能共享同一个读取位置
+// body实现了io.ReaderAt时每次返回独立的io.SectionReader, 否则只能读取一次, 不再重试
+func sectionBody(body io.ReadSeeker, start, size int64) func() (io.Reader, error) {
+	if ra, ok := body.(io.ReaderAt); ok {
+		return func() (io.Reader, error) {
+			return io.NewSectionReader(ra, start, size), nil
+		}
+	}
+
+	var used int32
+	return func() (io.Reader, error) {
+		if !atomic.CompareAndSwapInt32(&used, 0, 1) {
+			return nil, errNotRewindable
+		}
+		if _, err := body.Seek(start, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("Seek body err, %v", err)
+		}
+		return io.LimitReader(body, size), nil
+	}
+}
+
+var errNotRewindable = errors.New("Request body can not be rewound")
+
+var errNotResignable = errors.New("Request can not be resigned")
+
+type idempotentKey struct{}
+
+// markIdempotent: 把POST等默认不幂等的请求标记为可以重试, 比如批量删除
+func markIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	v, _ := req.Context().Value(idempotentKey{}).(bool)
+	return v
+}
@@ -0,0 +1,183 @@
+package ceph
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 32
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultDialTimeout         = 5 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+)
+
+// TransportOption: 创建http.Transport的参数, 为0的字段使用默认值
+type TransportOption struct {
+	// 连接池大小
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// 空闲连接的保留时间
+	IdleConnTimeout time.Duration
+
+	// 建立连接的超时时间
+	DialTimeout time.Duration
+	// TCP keep-alive间隔, <0表示关闭
+	KeepAlive time.Duration
+	// 发送完请求后等待响应头的超时时间, 0表示不限制
+	ResponseHeaderTimeout time.Duration
+
+	// 代理, 为nil时和http.DefaultTransport一样使用http.ProxyFromEnvironment(HTTP_PROXY | HTTPS_PROXY | NO_PROXY)
+	Proxy func(*http.Request) (*url.URL, error)
+	// 不使用任何代理, 包括环境变量中的代理
+	DisableProxy bool
+
+	// 使用https时的TLS配置, 可以通过NewTLSConfig生成
+	TLSConfig *tls.Config
+}
+
+func DefaultTransportOption() *TransportOption {
+	return &TransportOption{
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+		DialTimeout:         DefaultDialTimeout,
+		KeepAlive:           DefaultKeepAlive,
+		Proxy:               http.ProxyFromEnvironment,
+	}
+}
+
+// NewTransport: 根据opt创建http.Transport, opt为nil时使用DefaultTransportOption()
+func NewTransport(opt *TransportOption) *http.Transport {
+	if opt == nil {
+		opt = DefaultTransportOption()
+	}
+
+	var (
+		maxIdleConns        = opt.MaxIdleConns
+		maxIdleConnsPerHost = opt.MaxIdleConnsPerHost
+		idleConnTimeout     = opt.IdleConnTimeout
+		dialTimeout         = opt.DialTimeout
+		keepAlive           = opt.KeepAlive
+		proxy               = opt.Proxy
+	)
+	if maxIdleConns == 0 {
+		maxIdleConns = DefaultMaxIdleConns
+	}
+	if maxIdleConnsPerHost == 0 {
+		maxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if idleConnTimeout == 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+	if dialTimeout == 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	if opt.DisableProxy {
+		proxy = nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		ResponseHeaderTimeout: opt.ResponseHeaderTimeout,
+		TLSClientConfig:       opt.TLSConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// NewHTTPClient: 使用NewTransport(opt)创建http.Client
+// 不设置Client.Timeout, 单个请求的超时通过Ceph.DoContext控制
+func NewHTTPClient(opt *TransportOption) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(opt),
+	}
+}
+
+// TLSOption: 创建tls.Config的参数
+type TLSOption struct {
+	// PEM格式的CA证书文件, 为空时使用系统的根证书
+	CAFile string
+	// PEM格式的CA证书内容, 和CAFile一起添加到根证书中
+	CAPEM []byte
+
+	// 双向认证时客户端的证书和私钥文件(PEM), 必需同时设置
+	CertFile string
+	KeyFile  string
+
+	// 校验服务端证书时使用的域名(SNI), 为空时使用请求的host
+	ServerName string
+
+	// 不校验服务端证书, 仅用于测试环境
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig: 根据opt创建tls.Config, opt为nil时返回默认配置
+func NewTLSConfig(opt *TLSOption) (*tls.Config, error) {
+	config := &tls.Config{}
+	if opt == nil {
+		return config, nil
+	}
+
+	config.ServerName = opt.ServerName
+	config.InsecureSkipVerify = opt.InsecureSkipVerify
+
+	// 自定义CA
+	if len(opt.CAFile) > 0 || len(opt.CAPEM) > 0 {
+		pool := x509.NewCertPool()
+		if len(opt.CAFile) > 0 {
+			pem, err := ioutil.ReadFile(opt.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("Read CA file %s err, %v", opt.CAFile, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("No valid certificate in CA file %s", opt.CAFile)
+			}
+		}
+		if len(opt.CAPEM) > 0 && !pool.AppendCertsFromPEM(opt.CAPEM) {
+			return nil, errors.New("No valid certificate in CAPEM")
+		}
+		config.RootCAs = pool
+	}
+
+	// 客户端证书
+	if len(opt.CertFile) > 0 || len(opt.KeyFile) > 0 {
+		if len(opt.CertFile) <= 0 || len(opt.KeyFile) <= 0 {
+			return nil, errors.New("CertFile and KeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Load client certificate err, %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -1,19 +1,41 @@
 package ceph
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-// 基于当前主机的时间计算格林尼治时间
+// DetectContentType: 依次根据names的扩展名检测Content-Type, 都无法检测时返回binary/octet-stream
+func DetectContentType(names ...string) string {
+	for _, name := range names {
+		if ext := filepath.Ext(name); len(ext) > 0 {
+			if contentType := mime.TypeByExtension(ext); len(contentType) > 0 {
+				return contentType
+			}
+		}
+	}
+	return "binary/octet-stream"
+}
+
+// GMTime: 当前时间的RFC1123格式(GMT), 用作Date头
 func GMTime() string {
-	t := time.Now().Local()
-	t = t.Add(-8 * time.Hour)
-	return t.Format("Sat, 2 Jan 2006 15:04:05 GMT")
+	return time.Now().UTC().Format(http.TimeFormat)
+}
+
+// quoteETag: 给ETag加上引号, 用于If-Match等请求头和CompleteMultipartUpload
+func quoteETag(etag string) string {
+	return "\"" + strings.Trim(etag, "\"") + "\""
 }
 
 func Base64MD5(f *os.File) (string, error) {
@@ -32,3 +54,53 @@ func Base64MD5(f *os.File) (string, error) {
 
 	return b64, nil
 }
+
+func HexSHA256File(f *os.File) (string, error) {
+	if f == nil {
+		return "", errors.New("Bad file")
+	}
+
+	f.Seek(0, os.SEEK_SET)
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sleepContext: 等待d, ctx被取消时提前返回ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// progressReader: 读取时通过progress回调已读取的百分比[0,100], 最多每秒回调一次
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	progress func(float64)
+
+	read       int64
+	lastUpdate time.Time
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.read += int64(n)
+	if r.progress != nil && r.total > 0 {
+		if now := time.Now(); now.Sub(r.lastUpdate) >= time.Second {
+			r.progress(float64(r.read * int64(100) / r.total))
+			r.lastUpdate = now
+		}
+	}
+	return n, err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"reflect"
@@ -32,6 +33,12 @@ func init() {
 	funcMap["putobj"] = PutObj
 	funcMap["getobj"] = GetObj
 	funcMap["getobjinfo"] = GetObjInfo
+	funcMap["presign"] = Presign
+	funcMap["listobjs"] = ListObjs
+	funcMap["delobj"] = DelObj
+	funcMap["mpputobj"] = MultipartPutObj
+	funcMap["pgetobj"] = ParallelGetObj
+	funcMap["objacl"] = ObjACL
 }
 
 func main() {
@@ -94,6 +101,12 @@ func GetBucket(c *ceph.Ceph) {
 	log.Printf("Marker      : %s\n", gbresp.Marker)
 	log.Printf("MaxKeys     : %d\n", gbresp.MaxKeys)
 	log.Printf("IsTruncated : %v\n", gbresp.IsTruncated)
+	for _, cp := range gbresp.CommonPrefixes {
+		log.Printf("  %s\n", cp.Prefix)
+	}
+	for _, o := range gbresp.Contents {
+		log.Printf("  %s %d %s\n", o.Key, o.Size, o.LastModified.Format(time.RFC3339))
+	}
 }
 
 func PutObj(c *ceph.Ceph) {
@@ -145,5 +158,109 @@ func GetObjInfo(c *ceph.Ceph) {
 		return
 	}
 
-	log.Printf("[GetObjInfo] Size:%d, LastModified:%s, ETag:%s\n", goiresp.Size, goiresp.LastModified, goiresp.ETag)
+	if !goiresp.IsExisted {
+		log.Printf("[GetObjInfo] Object %s not existed\n", objName)
+		return
+	}
+
+	log.Printf("[GetObjInfo] Size:%d, LastModified:%s, ETag:%s, ContentType:%s, Metadata:%v\n", goiresp.Size, goiresp.LastModified.Format(time.RFC3339), goiresp.ETag, goiresp.ContentType, goiresp.Metadata)
+}
+
+func Presign(c *ceph.Ceph) {
+	req := ceph.NewPresignRequest("PUT", bucket, objName).SetExpired(600)
+	resp := c.Do(req)
+	if err := resp.Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	presp, ok := resp.(*ceph.PresignResponse)
+	if !ok {
+		log.Printf("Invalid response type, type is %v", reflect.TypeOf(resp))
+		return
+	}
+
+	log.Printf("[Presign] %s %s\n", presp.Method, presp.Url)
+}
+
+func ListObjs(c *ceph.Ceph) {
+	opt := ceph.DefaultGetBucketOption()
+	opt.Delimiter = "/"
+
+	it := ceph.NewObjectIterator(context.Background(), c, bucket, opt, 0)
+	for it.Next() {
+		if it.IsPrefix() {
+			log.Printf("%s\n", it.Prefix())
+			continue
+		}
+		o := it.Object()
+		log.Printf("%s %d\n", o.Key, o.Size)
+	}
+	if err := it.Err(); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
+
+func DelObj(c *ceph.Ceph) {
+	req := ceph.NewDeleteObjRequest(bucket, objName)
+	resp := c.Do(req)
+	if err := resp.Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	log.Printf("DelObj %s/%s done\n", bucket, objName)
+}
+
+func MultipartPutObj(c *ceph.Ceph) {
+	start := time.Now()
+	req := ceph.NewMultipartPutObjRequest(bucket, objName, filePath).SetWorkers(8)
+	resp := c.Do(req)
+	if err := resp.Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	mpresp, ok := resp.(*ceph.MultipartPutObjResponse)
+	if !ok {
+		log.Printf("Invalid response type, type is %v", reflect.TypeOf(resp))
+		return
+	}
+
+	log.Printf("MultipartPutObj done, elapse: %v\n", time.Since(start))
+	log.Printf("UploadId : %s\n", mpresp.UploadId)
+	log.Printf("ETag     : %s\n", mpresp.ETag)
+}
+
+func ParallelGetObj(c *ceph.Ceph) {
+	start := time.Now()
+	req := ceph.NewParallelGetObjRequest(bucket, objName, filePath).SetWorkers(8)
+	resp := c.Do(req)
+	if err := resp.Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	log.Printf("ParallelGetObj done, elapse: %v\n", time.Since(start))
+	log.Printf("Size : %d\n", resp.(*ceph.ParallelGetObjResponse).Size)
+}
+
+func ObjACL(c *ceph.Ceph) {
+	req := ceph.NewPutObjACLRequest(bucket, objName).SetACL(ceph.ACLPublicRead)
+	if err := c.Do(req).Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	resp := c.Do(ceph.NewGetObjACLRequest(bucket, objName))
+	if err := resp.Err(); err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	acl := resp.(*ceph.GetObjACLResponse)
+	log.Printf("[ObjACL] Owner:%s\n", acl.Owner.ID)
+	for _, g := range acl.Grants {
+		log.Printf("[ObjACL] %s %s%s\n", g.Permission, g.Grantee.ID, g.Grantee.URI)
+	}
 }